@@ -6,123 +6,418 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	"unsafe"
 )
 
+// UnmarshalOptions は Unmarshal の挙動を設定します
+type UnmarshalOptions struct {
+	// AllowPartial が true の場合、requiredなフィールドがバイト列に含まれていなくてもエラーにしません
+	AllowPartial bool
+	// Merge が true の場合、すでに値がSetされている v をゼロ値にせず、バイト列の内容をマージします
+	// マージの規則は Merge 関数と同じです
+	// マージ先ですでにSetされているrequiredなフィールドは、バイト列に含まれていなくても RequiredNotSetError になりません
+	Merge bool
+	// Strict が true の場合、署名の検証などのために正規でないエンコーディングを *StrictError として報告します
+	// 以下を正規でないエンコーディングとして扱います
+	//   - 最短でないvarint(e.g. 0x80 0x00)
+	//   - 昇順に並んでいないfield number
+	//   - 複数回現れるrepeatedでないフィールド
+	//   - 32bitに収まらないint32, uint32, sint32, enumの値
+	//   - 0か1でないboolの値
+	//   - packedとして宣言されたフィールドのunpackedなエンコーディング
+	Strict bool
+	// CheckRange が true の場合、int32, uint32, sint32, enumのフィールドに32bitに収まらない値が現れると *RangeError を返します
+	// 仕様上は上位bitを切り捨てて読み取るので、デフォルトでは切り捨てます
+	// int64からint32へのようにスキーマを変更した場合に、送信側が範囲外の値を送っていることを検出するために利用します
+	CheckRange bool
+	// AllowInvalidUTF8 が true の場合、stringのフィールドの値がUTF-8として正しいかを検証しません
+	// デフォルトでは公式のランタイムのproto3の挙動と同じく、不正なUTF-8を含む値は *InvalidUTF8Error になります
+	// フィールドごとに検証しない場合は、タグに `noutf8` を指定します
+	AllowInvalidUTF8 bool
+	// Alias が true の場合、bytesのフィールドは入力のバイト列をコピーせずに参照し、stringのフィールドもunsafeにコピーせずに参照します
+	// デフォルトではどちらもコピーするので、 Unmarshal の後に入力のバイト列を再利用しても安全です
+	// Alias を指定する場合、呼び出し側はメッセージを利用している間、入力のバイト列を変更せずに保持する必要があります
+	Alias bool
+	// Paths を指定すると、 `user.address.city` のようにフィールド名を "." で繋げたパスのフィールドだけを読み取ります
+	// パスに含まれないフィールドはバイト列のまま読み飛ばし、埋め込みメッセージはパスがその中を通る場合だけ読み取ります
+	// 読み取らなかったフィールドはrequiredであっても RequiredNotSetError になりません
+	// どのパスがバイト列に含まれていたかは UnmarshalPaths で取得できます
+	Paths []string
+}
+
+// RequiredNotSetError はrequiredなフィールドがバイト列に含まれていなかったことを表します
+// Paths は見つからなかったフィールドのパスで、埋め込みメッセージのフィールドは `parent.child` のように表します
+type RequiredNotSetError struct {
+	Paths []string
+}
+
+func (e *RequiredNotSetError) Error() string {
+	return fmt.Sprintf("required fields not set: %s", strings.Join(e.Paths, ", "))
+}
+
+// RangeError は UnmarshalOptions.CheckRange が指定された場合に、32bitのフィールドに範囲外の値が現れたことを表します
+// Value はwireバイナリ上のvarintの値です
+type RangeError struct {
+	Path  string
+	Type  string
+	Value uint64
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%s value %d of field %s overflows 32 bits", e.Type, e.Value, e.Path)
+}
+
+// InvalidUTF8Error はstringのフィールドの値が不正なUTF-8を含んでいることを表します
+type InvalidUTF8Error struct {
+	Path string
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("field %s contains invalid UTF-8", e.Path)
+}
+
+// Unmarshal はwireバイナリを読み取って、 `protowire` タグが付与されたstructのポインタである v にbindします
 func Unmarshal(b []byte, v interface{}) error {
+	return UnmarshalOptions{}.Unmarshal(b, v)
+}
+
+// Unmarshal は o の設定に従ってwireバイナリを読み取り、 v にbindします
+//
+// バイト列に同じフィールドが複数回現れた場合、protobufのエンコーディングの仕様に従って以下のように扱います
+//   - repeatedでないスカラー値: 最後に現れた値で上書きします
+//   - 埋め込みメッセージ: それぞれの値をマージします
+//   - repeated: 現れた順に連結します
+//   - oneof: 最後に現れたメンバーの値だけを保持し、同じメンバーが続けて現れた場合は上記と同様にマージします
+//
+// https://developers.google.com/protocol-buffers/docs/encoding#optional
+func (o UnmarshalOptions) Unmarshal(b []byte, v interface{}) error {
+	_, err := o.unmarshal(b, v)
+	return err
+}
+
+func (o UnmarshalOptions) unmarshal(b []byte, v interface{}) (*decodeState, error) {
+	if rv := reflect.ValueOf(v); !o.Merge && rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	}
+	d := newDecodeState(o)
+	d.capBase = cap(b)
+	if err := d.unmarshalMessage(b, v); err != nil {
+		return nil, err
+	}
+	d.finish(reflect.ValueOf(v))
+	return d, d.result()
+}
+
+// decodeState は1回の Unmarshal の間、埋め込みメッセージをまたいで共有する状態を保持します
+// path はいま読み取っているフィールドのパスで、エラーの報告などに利用します
+// capBase は Unmarshal に渡されたバイト列のcapで、 Strict で違反の位置を求めるために利用します
+// mask はいま読み取っているメッセージで読み取るフィールドで、nilの場合はすべてのフィールドを読み取ります
+// messages は読み取ったメッセージのstructのポインタごとの状態です
+type decodeState struct {
+	opts       UnmarshalOptions
+	path       []string
+	missing    []string
+	capBase    int
+	violations []Violation
+	mask       fieldMask
+	present    map[string]bool
+	messages   map[interface{}]*messageState
+}
+
+// messageState は1つのメッセージのstructに現れたフィールドを記録します
+// 埋め込みメッセージがバイト列の中で複数回に分かれて現れた場合も同じstructにマージされるので、
+// requiredなフィールドが含まれていたかはすべての出現を合わせて判断します
+// path と mask は初めて読み取ったときの decodeState の値で、 finish で利用します
+type messageState struct {
+	pm   protoMetadata
+	seen map[FieldNumber]bool
+	path []string
+	mask fieldMask
+}
+
+func newDecodeState(o UnmarshalOptions) *decodeState {
+	return &decodeState{opts: o, mask: newFieldMask(o.Paths)}
+}
+
+// message は structのポインタ v のメッセージの messageState を返します。初めて読み取るメッセージであれば作成します
+func (d *decodeState) message(v interface{}) (*messageState, error) {
+	if ms, ok := d.messages[v]; ok {
+		return ms, nil
+	}
 	pm, err := newProtoMetadata(v)
 	if err != nil {
-		return fmt.Errorf("failed to parse protoMetadata from input interface{}: %w", err)
+		return nil, fmt.Errorf("failed to parse protoMetadata from input interface{}: %w", err)
+	}
+	ms := &messageState{
+		pm:   pm,
+		seen: make(map[FieldNumber]bool),
+		path: append([]string{}, d.path...),
+		mask: d.mask,
+	}
+	if d.messages == nil {
+		d.messages = make(map[interface{}]*messageState)
+	}
+	d.messages[v] = ms
+	return ms, nil
+}
+
+// finish はメッセージ全体を読み取り終わった後に、ルートのメッセージ rv から最終的な値をたどって、読み取ったメッセージに finishMessage を適用します
+// oneofの実装が後から別の実装に置き換えられた場合のように、最終的な値から外れたメッセージは対象にしません
+func (d *decodeState) finish(rv reflect.Value) {
+	path, mask := d.path, d.mask
+	d.finishValue(rv, make(map[interface{}]bool))
+	d.path, d.mask = path, mask
+}
+
+// finishValue は埋め込みメッセージの値 rv を、repeatedであれば要素ごとにたどります
+// visited にはすでに finishMessage を適用したメッセージを記録し、同じメッセージを2回数えないようにします
+func (d *decodeState) finishValue(rv reflect.Value, visited map[interface{}]bool) {
+	switch {
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Ptr:
+		for i := 0; i < rv.Len(); i++ {
+			d.finishValue(rv.Index(i), visited)
+		}
+	case rv.Kind() == reflect.Ptr && !rv.IsNil():
+		v := rv.Interface()
+		ms, ok := d.messages[v]
+		if !ok || visited[v] {
+			return
+		}
+		visited[v] = true
+		d.path, d.mask = ms.path, ms.mask
+		d.finishMessage(ms.pm, ms.seen)
+		for _, fm := range ms.pm.fields {
+			if fm.pt == protoEmbed {
+				d.finishValue(fm.rv, visited)
+			}
+		}
+		for _, ofm := range ms.pm.oneOfFields {
+			if ofm.isSet() && ofm.protoFieldMetadata.pt == protoEmbed {
+				_, fm := ofm.bindImplement()
+				d.finishValue(fm.rv, visited)
+			}
+		}
+		if em := ms.pm.extensions; em != nil && !em.embed.isNil() {
+			for _, ef := range em.rv.Addr().Interface().(*Extensions).fields {
+				if ef.value.IsValid() {
+					d.finishValue(ef.value.Elem(), visited)
+				}
+			}
+		}
+	}
+}
+
+// result はメッセージ全体を読み取り終わった後に、 Strict で見つかった違反や見つからなかったrequiredなフィールドをエラーとして返します
+func (d *decodeState) result() error {
+	if len(d.violations) > 0 {
+		return &StrictError{Violations: d.violations}
+	}
+	if len(d.missing) > 0 && !d.opts.AllowPartial {
+		sort.Strings(d.missing)
+		return &RequiredNotSetError{Paths: d.missing}
+	}
+	return nil
+}
+
+// unmarshalMessage はあるメッセージのバイト列を読み取って v にbindします
+// バイト列に含まれていなかったrequiredなフィールドやデフォルト値は、すべての出現をマージした後に finish で扱います
+func (d *decodeState) unmarshalMessage(b []byte, v interface{}) error {
+	ms, err := d.message(v)
+	if err != nil {
+		return err
 	}
 
+	var lastFn FieldNumber
 	for len(b) > 0 {
-		fn, wt, n, err := parseTag(b)
+		fn, wt, n, err := ConsumeTag(b)
 		if err != nil {
 			return fmt.Errorf("failed to read tag: %w", err)
 		}
+		tag := b[:n]
 		b = b[n:]
+		if d.opts.Strict {
+			d.checkTag(tag, fn, lastFn)
+		}
+		lastFn = fn
 
-		fm, ok := pm.fields[fn]
-		if ok {
-			if !fm.rv.CanSet() {
-				return fmt.Errorf("cant't set field, field type: %s", fm.rv.Type().String())
-			}
-			n, err = bindBytes(fm, wt, b)
-			if err != nil {
-				return fmt.Errorf("failed to read field value: %w", err)
-			}
-			b = b[n:]
+		n, err = d.unmarshalField(ms.pm, reflect.TypeOf(v).Elem(), ms.seen, fn, wt, tag, b)
+		if err != nil {
+			return err
 		}
-		ofm, ok := pm.oneOfFields[fn]
-		if ok {
-			if !ofm.protoFieldMetadata.rv.CanSet() || !ofm.iface.CanSet() {
-				return fmt.Errorf("cant't set oneof field, field type: %s", ofm.protoFieldMetadata.rv.Type().String())
-			}
-			n, err = bindBytes(ofm.protoFieldMetadata, wt, b)
+		b = b[n:]
+	}
+	return nil
+}
+
+// unmarshalField はタグを読み取った後のバイト列 b から1つのフィールドの値を読み取って pm のフィールドにbindします
+// rt はメッセージのstructの型で、 seen にはすでに現れたフィールドを記録します。読み取ったバイト数を返します
+func (d *decodeState) unmarshalField(pm protoMetadata, rt reflect.Type, seen map[FieldNumber]bool, fn FieldNumber, wt WireType, tag, b []byte) (n int, err error) {
+	if d.maskOut(pm, fn) {
+		if n, err = ConsumeFieldValue(wt, b); err != nil {
+			return 0, fmt.Errorf("failed to skip masked field %d: %w", fn, err)
+		}
+		return n, nil
+	}
+	_, isField := pm.fields[fn]
+	_, isOneOfField := pm.oneOfFields[fn]
+	if !isField && !isOneOfField {
+		// 拡張フィールドとして受け付けるfield numberであれば拡張として読み取り、そうでなければ未知のフィールドとして読み飛ばします
+		if pm.extensions != nil && pm.extensions.inRange(fn) {
+			n, err = d.bindExtension(pm.extensions, rt, fn, wt, tag, b)
 			if err != nil {
-				return fmt.Errorf("failed to read oneof field value: %w", err)
+				return 0, fmt.Errorf("failed to read extension field %d: %w", fn, err)
 			}
-			ofm.iface.Set(ofm.implement)
-			b = b[n:]
+			return n, nil
+		}
+		if n, err = ConsumeFieldValue(wt, b); err != nil {
+			return 0, fmt.Errorf("failed to skip unknown field %d: %w", fn, err)
 		}
+		return n, nil
 	}
-	return nil
-}
 
-// parseTag はfield numberとwire typeを読み取ります。読み取りに成功すると読み取ったバイト数も返します。
-func parseTag(b []byte) (fn fieldNumber, wt wireType, n int, err error) {
-	tag, n, err := readVarint(b)
+	fm, ok := pm.fields[fn]
+	if ok {
+		if !fm.rv.CanSet() {
+			return 0, fmt.Errorf("cant't set field %s, field type: %s", fm.label(), fm.rv.Type().String())
+		}
+		if err := fm.embed.alloc(); err != nil {
+			return 0, err
+		}
+		leave := d.enterMask(fm.name)
+		n, err = d.bindBytes(fm, wt, b)
+		leave()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read field %s value: %w", fm.label(), err)
+		}
+		if d.opts.Strict {
+			d.checkField(fm, wt, tag, b[:n], seen[fn])
+		}
+		seen[fn] = true
+		return n, nil
+	}
+	ofm := pm.oneOfFields[fn]
+	if !ofm.protoFieldMetadata.rv.CanSet() || !ofm.iface.CanSet() {
+		return 0, fmt.Errorf("cant't set oneof field, field type: %s", ofm.protoFieldMetadata.rv.Type().String())
+	}
+	if err := ofm.embed.alloc(); err != nil {
+		return 0, err
+	}
+	impl, fm := ofm.bindImplement()
+	leave := d.enterMask(fm.name)
+	n, err = d.bindBytes(fm, wt, b)
+	leave()
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("failed to read varint field: %w", err)
+		return 0, fmt.Errorf("failed to read oneof %s field %s value: %w", ofm.name, fm.label(), err)
 	}
-	// 仕様でtype, field_number合わせて32bitまでなので超えてたらエラー
-	if tag > math.MaxUint32 {
-		return 0, 0, 0, fmt.Errorf("invalid tag size, max: %d, got: %d", math.MaxUint32, tag)
+	if d.opts.Strict {
+		d.checkField(fm, wt, tag, b[:n], seen[fn])
 	}
-	// 下位3bitはtype, それ以外はfield_number
-	fn = fieldNumber(tag >> 3)
-	wt = wireType(tag & 0x7)
-	return fn, wt, n, nil
+	ofm.iface.Set(impl)
+	seen[fn] = true
+	return n, nil
 }
 
-// bindBytes は与えられた protoFieldMetadata をもとにバイト列を protoFieldMetadata.rv にbindします
-func bindBytes(fm protoFieldMetadata, wt wireType, b []byte) (n int, err error) {
-	// バイナリから読み取ったwire typeは基本的にstruct tagのwire typeと一致します
-	// structのフィールド定義がpacked repeated fieldsの場合はwire typeはlength delimitedもありうるので一致していなくても許容します
-	if wt != fm.wt && !fm.fts.Has(fieldPacked) {
-		return 0, fmt.Errorf("wrong wire type, struct wire tag: %d, binary wire tag: %d", fm.wt, wt)
+// finishMessage はメッセージを読み取り終わった後に、バイト列に含まれていなかったrequiredなフィールドを d.missing に記録し、
+// デフォルト値が指定されたフィールドにはデフォルト値をSetします
+// Merge の場合、マージ先ですでに値がSetされているrequiredなフィールドは含まれていたものとして扱います
+func (d *decodeState) finishMessage(pm protoMetadata, seen map[FieldNumber]bool) {
+	for fn, fm := range pm.fields {
+		if seen[fn] || d.maskOut(pm, fn) {
+			continue
+		}
+		if fm.fts.Has(fieldRequired) && !(d.opts.Merge && !fm.rv.IsZero()) {
+			d.missing = append(d.missing, d.fieldPath(fm.name))
+		}
+		// バイト列に含まれていなかったフィールドにはデフォルト値を適用します
+		// 呼び出し元がすでに値をSetしている場合はその値を優先します
+		// nilのポインタで埋め込まれたstructは、デフォルト値のためには割り当てません
+		if fm.rv.IsZero() && !fm.embed.isNil() {
+			fm.setDefault()
+		}
 	}
+}
+
+// fieldPath はいま読み取っているメッセージのパスに name を繋げたフィールドのパスを返します
+func (d *decodeState) fieldPath(name string) string {
+	return strings.Join(append(d.path[:len(d.path):len(d.path)], name), ".")
+}
+
+// bindBytes は与えられた protoFieldMetadata をもとにバイト列を protoFieldMetadata.rv にbindします
+func (d *decodeState) bindBytes(fm protoFieldMetadata, wt WireType, b []byte) (n int, err error) {
+	d.path = append(d.path, fm.name)
+	defer func() { d.path = d.path[:len(d.path)-1] }()
 
 	ptwt, err := fm.pt.toWireType()
 	if err != nil {
 		return 0, fmt.Errorf("failed to convert proto type to wire type: %w", err)
 	}
+	// varint, 64-bit, 32-bitのrepeatedなフィールドは、packedとして宣言されているかどうかに関わらず
+	// packed(length delimited)とunpackedのどちらのエンコーディングも受け付ける必要があります
+	// https://developers.google.com/protocol-buffers/docs/encoding#packed
+	// >Protocol buffer parsers must be able to parse repeated fields that were compiled as packed as if they were not packed, and vice versa.
+	repeatedScalar := fm.isRepeatedScalar()
+
+	// バイナリから読み取ったwire typeは基本的にproto typeのwire typeと一致します
+	// repeatedなスカラー値の場合はpackedとしてlength delimitedもありうるので一致していなくても許容します
+	if wt != ptwt && !(repeatedScalar && wt == WireLengthDelimited) {
+		return 0, fmt.Errorf("wrong wire type, expected wire type for proto type %s: %d, binary wire type: %d", fm.pt, ptwt, wt)
+	}
+
 	switch wt {
-	case wireVarint:
-		// structのフィールド定義がpacked repeated fieldsだった場合は互換のためlength delimitedでなくともsliceとしてパースします
-		if fm.fts.Has(fieldPacked) && fm.wt == wireLengthDelimited {
+	case WireVarint:
+		if repeatedScalar {
 			elem := reflect.New(fm.rv.Type().Elem()).Elem()
-			n, err := bindVarint(fm.pt, elem, b)
+			n, err := d.bindVarint(fm.pt, elem, b)
 			if err != nil {
-				return 0, fmt.Errorf("failed to read packed varint field: %w", err)
+				return 0, fmt.Errorf("failed to read repeated varint field: %w", err)
 			}
 			fm.rv.Set(reflect.Append(fm.rv, elem))
 			return n, nil
 		}
-		return bindVarint(fm.pt, fm.rv, b)
-	case wireFixed64:
-		// structのフィールド定義がpacked repeated fieldsだった場合は互換のためlength delimitedでなくともsliceとしてパースします
-		if ptwt == wireFixed64 && fm.fts.Has(fieldPacked) && fm.rv.Kind() == reflect.Slice {
+		return d.bindVarint(fm.pt, fm.rv, b)
+	case WireFixed64:
+		if repeatedScalar {
 			elem := reflect.New(fm.rv.Type().Elem()).Elem()
 			n, err := bindFixed64(fm.pt, elem, b)
 			if err != nil {
-				return 0, fmt.Errorf("failed to read packed 64-bit field: %w", err)
+				return 0, fmt.Errorf("failed to read repeated 64-bit field: %w", err)
 			}
 			fm.rv.Set(reflect.Append(fm.rv, elem))
 			return n, nil
 		}
 		return bindFixed64(fm.pt, fm.rv, b)
-	case wireLengthDelimited:
+	case WireLengthDelimited:
 		// 該当フィールドがsliceとして宣言されていれば、複数回パースできるようにします
-		// LengthDelimitedはpackedとして宣言できないので、packed形式のことは考慮しません
-		// https://developers.google.com/protocol-buffers/docs/encoding#optional
-		// >Only repeated fields of primitive numeric types (types which use the varint, 32-bit, or 64-bit wire types) can be declared "packed".
-		if fm.rv.Kind() == reflect.Slice && fm.rv.Type() != reflect.TypeOf([]byte(nil)) && !ptwt.Packable() {
+		// packedなrepeatedなスカラー値は bindLengthDelimited がまとめてsliceに追加します
+		if isRepeatedType(fm.rv.Type()) && !repeatedScalar {
 			elem := reflect.New(fm.rv.Type().Elem()).Elem()
-			n, err := bindLengthDelimited(fm.pt, fm.fts, elem, b)
+			n, err := d.bindLengthDelimited(fm.pt, elem, b)
 			if err != nil {
 				return 0, fmt.Errorf("failed to read repeatable length-delimited field: %w", err)
 			}
+			if err := d.validateUTF8(fm, elem); err != nil {
+				return 0, err
+			}
 			fm.rv.Set(reflect.Append(fm.rv, elem))
 			return n, nil
 		}
-		return bindLengthDelimited(fm.pt, fm.fts, fm.rv, b)
-	case wireFixed32:
-		// structのフィールド定義がpacked repeated fieldsだった場合は互換のためlength delimitedでなくともsliceとしてパースします
-		if ptwt == wireFixed32 && fm.fts.Has(fieldPacked) && fm.rv.Kind() == reflect.Slice {
+		n, err := d.bindLengthDelimited(fm.pt, fm.rv, b)
+		if err != nil {
+			return 0, err
+		}
+		if err := d.validateUTF8(fm, fm.rv); err != nil {
+			return 0, err
+		}
+		return n, nil
+	case WireFixed32:
+		if repeatedScalar {
 			elem := reflect.New(fm.rv.Type().Elem()).Elem()
 			n, err := bindFixed32(fm.pt, elem, b)
 			if err != nil {
-				return 0, fmt.Errorf("failed to read packed 32-bit field: %w", err)
+				return 0, fmt.Errorf("failed to read repeated 32-bit field: %w", err)
 			}
 			fm.rv.Set(reflect.Append(fm.rv, elem))
 			return n, nil
@@ -133,27 +428,45 @@ func bindBytes(fm protoFieldMetadata, wt wireType, b []byte) (n int, err error)
 	}
 }
 
+// validateUTF8 はstringのフィールドに読み取った値 rv が正しいUTF-8かを検証します
+// AllowInvalidUTF8 やタグの `noutf8` が指定されている場合は検証しません
+func (d *decodeState) validateUTF8(fm protoFieldMetadata, rv reflect.Value) error {
+	if fm.pt != protoString || fm.noUTF8 || d.opts.AllowInvalidUTF8 {
+		return nil
+	}
+	if !utf8.ValidString(rv.String()) {
+		return &InvalidUTF8Error{Path: strings.Join(d.path, ".")}
+	}
+	return nil
+}
+
 // bindVarint はwire typeがvarintなフィールドを読み取って、渡された rv にbindします
 // bindに成功した場合読み取ったバイト数を返します
 // sint64, sint32 が指定された場合はバイト数の削減のためzigzag encodingを利用します
-func bindVarint(pt protoType, rv reflect.Value, b []byte) (n int, err error) {
-	val, n, err := readVarint(b)
+// CheckRange が指定された場合、32bitのフィールドに範囲外の値が現れると切り捨てずに *RangeError を返します
+func (d *decodeState) bindVarint(pt protoType, rv reflect.Value, b []byte) (n int, err error) {
+	val, n, err := ConsumeVarint(b)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read varint field: %w", err)
 	}
+	if d.opts.CheckRange && !varintInRange(pt, val) {
+		return 0, &RangeError{Path: strings.Join(d.path, "."), Type: string(pt), Value: val}
+	}
 	switch {
 	case (pt == protoInt64 || pt == protoSint64) && rv.Kind() == reflect.Int64:
 		i := int64(val)
 		if pt.isZigzag() {
-			i = int64((uint64(i) >> 1) ^ uint64(((i&1)<<63)>>63))
+			i = DecodeZigZag(val)
 		}
 		rv.SetInt(i)
 	case (pt == protoInt32 || pt == protoSint32) && rv.Kind() == reflect.Int32:
 		i := int32(val)
 		if pt.isZigzag() {
-			i = int32((uint32(i) >> 1) ^ uint32(((i&1)<<31)>>31))
+			i = int32(DecodeZigZag(uint64(uint32(val))))
 		}
 		rv.SetInt(int64(i))
+	case pt == protoEnum && rv.Kind() == reflect.Int32:
+		rv.SetInt(int64(int32(val)))
 	case pt == protoUint64 && rv.Kind() == reflect.Uint64, pt == protoUint32 && rv.Kind() == reflect.Uint32:
 		rv.SetUint(val)
 	case pt == protoBool && rv.Kind() == reflect.Bool:
@@ -164,9 +477,26 @@ func bindVarint(pt protoType, rv reflect.Value, b []byte) (n int, err error) {
 	return n, nil
 }
 
+// varintInRange はvarintの値がproto typeの範囲に収まっているかを返します
+// int32, enumの負の値は64bitに符号拡張してエンコードされるので、int32として符号拡張した値と一致する必要があります
+// sint32はzigzag encodingした値、uint32はそのままの値が32bitに収まっている必要があります
+func varintInRange(pt protoType, v uint64) bool {
+	switch pt {
+	case protoInt32, protoEnum:
+		return int64(v) == int64(int32(v))
+	case protoUint32, protoSint32:
+		return v <= math.MaxUint32
+	default:
+		return true
+	}
+}
+
 // bindFixed64 はバイト列からwire typeが64-bitなフィールドを読み取って、渡された rv にbindします
 // bindに成功した場合読み取ったバイト数を返します
 func bindFixed64(pt protoType, rv reflect.Value, b []byte) (n int, err error) {
+	if len(b) < 8 {
+		return 0, errors.New("unexpected end of 64-bit field")
+	}
 	val := binary.LittleEndian.Uint64(b)
 	n = 8
 	switch {
@@ -189,63 +519,91 @@ func bindFixed64(pt protoType, rv reflect.Value, b []byte) (n int, err error) {
 // 考慮事項として、lengthDelimitedには以下のように特殊な値が設定されている場合があるためそのようなメッセージも処理できるようにしています
 // - embed: 別のメッセージがバイナリとしてフィールドに入れ子のように埋め込まれている
 // - packed: varint, fixed64, fixed32のいずれかのwire typeの値が1フィールドに複数設定されている
-func bindLengthDelimited(pt protoType, fts fieldTypes, rv reflect.Value, b []byte) (n int, err error) {
-	byteLen, n, err := readVarint(b)
+func (d *decodeState) bindLengthDelimited(pt protoType, rv reflect.Value, b []byte) (n int, err error) {
+	byteLen, n, err := ConsumeVarint(b)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read varint field: %w", err)
 	}
+	if byteLen > uint64(len(b)-n) {
+		return 0, errors.New("unexpected end of length-delimited field")
+	}
 	val := b[n : n+int(byteLen)]
 	n += int(byteLen)
 
 	switch {
 	case pt == protoString && rv.Kind() == reflect.String:
+		if d.opts.Alias {
+			rv.SetString(unsafeString(val))
+			break
+		}
 		rv.SetString(string(val))
 	case pt == protoBytes && rv.Type() == reflect.TypeOf([]byte(nil)):
-		rv.SetBytes(val)
+		if d.opts.Alias {
+			rv.SetBytes(val)
+			break
+		}
+		rv.SetBytes(append([]byte{}, val...))
+	case pt == protoRaw && pt.matchGoType(rv.Type()):
+		// rawは埋め込みメッセージなので、複数回に分かれて現れた場合はマージと同じ結果になるようにバイト列を連結します
+		// 前の値は入力やマージ先のバイト列を参照していることがあるので、連結するときは新しいバイト列を確保します
+		if n := rv.Len(); n > 0 {
+			rv.SetBytes(append(rv.Bytes()[:n:n], val...))
+			break
+		}
+		if d.opts.Alias {
+			rv.SetBytes(val)
+			break
+		}
+		rv.SetBytes(append([]byte{}, val...))
+	case pt == protoEmbed && rv.Type() == lazyType:
+		prev, _ := rv.Interface().(*Lazy)
+		rv.Set(reflect.ValueOf(newLazy(prev, val, d.opts)))
 	case pt == protoEmbed && rv.Kind() == reflect.Ptr:
 		if rv.IsNil() {
 			rv.Set(reflect.New(rv.Type().Elem()))
 		}
-		if err := Unmarshal(val, rv.Interface()); err != nil {
+		if err := d.unmarshalMessage(val, rv.Interface()); err != nil {
 			return 0, fmt.Errorf("failed to read enbed field: %w", err)
 		}
-	case fts.Has(fieldPacked) && fts.Has(fieldRepeated) && rv.Kind() == reflect.Slice:
+	case rv.Kind() == reflect.Slice:
 		// packed repeated fieldsの場合は該当フィールドのproto定義上の型情報を元にどのwire typeとしてパースすればよいか判断する
 		ptwt, err := pt.toWireType()
 		if err != nil {
 			return 0, fmt.Errorf("failed to convert prototype to wiretype: %w", err)
 		}
 		switch ptwt {
-		case wireVarint:
+		case WireVarint:
 			for len(val) > 0 {
 				elem := reflect.New(rv.Type().Elem()).Elem()
-				m, err := bindVarint(pt, elem, val)
+				m, err := d.bindVarint(pt, elem, val)
 				if err != nil {
 					return 0, fmt.Errorf("failed to read packed varint field: %w", err)
 				}
 				val = val[m:]
 				rv.Set(reflect.Append(rv, elem))
 			}
-		case wireFixed64:
+		case WireFixed64:
 			for len(val) > 0 {
 				elem := reflect.New(rv.Type().Elem()).Elem()
 				m, err := bindFixed64(pt, elem, val)
 				if err != nil {
-					return 0, errors.New("failed to read packed 64-bit field")
+					return 0, fmt.Errorf("failed to read packed 64-bit field: %w", err)
 				}
 				val = val[m:]
 				rv.Set(reflect.Append(rv, elem))
 			}
-		case wireFixed32:
+		case WireFixed32:
 			for len(val) > 0 {
 				elem := reflect.New(rv.Type().Elem()).Elem()
 				m, err := bindFixed32(pt, elem, val)
 				if err != nil {
-					return 0, errors.New("failed to read packed 32-bit field")
+					return 0, fmt.Errorf("failed to read packed 32-bit field: %w", err)
 				}
 				val = val[m:]
 				rv.Set(reflect.Append(rv, elem))
 			}
+		default:
+			return 0, fmt.Errorf("proto type %s can not be packed", pt)
 		}
 	default:
 		return 0, fmt.Errorf("unsupported type of length-delimited, proto type: %s, struct field type: %s", pt, rv.Type().String())
@@ -253,9 +611,18 @@ func bindLengthDelimited(pt protoType, fts fieldTypes, rv reflect.Value, b []byt
 	return n, nil
 }
 
+// unsafeString はバイト列をコピーせずにstringとして参照します
+// stringのヘッダはsliceのヘッダの先頭と同じレイアウトなので、そのまま読み替えられます
+func unsafeString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
 // bindFixed32 はバイト列からwire typeがfixed32なフィールドを読み取って、渡された rv にbindします
 // bindに成功した場合読み取ったバイト数を返します
 func bindFixed32(pt protoType, rv reflect.Value, b []byte) (n int, err error) {
+	if len(b) < 4 {
+		return 0, errors.New("unexpected end of 32-bit field")
+	}
 	val := binary.LittleEndian.Uint32(b)
 	n = 4
 	switch {
@@ -267,33 +634,10 @@ func bindFixed32(pt protoType, rv reflect.Value, b []byte) (n int, err error) {
 		rv.SetFloat(float64(math.Float32frombits(val)))
 	default:
 		return 0, fmt.Errorf(
-			"unsupported type of 64-bit, proto type: %s, struct field type: %s",
+			"unsupported type of 32-bit, proto type: %s, struct field type: %s",
 			pt,
 			rv.Type().String(),
 		)
 	}
 	return n, nil
 }
-
-// readVarint は可変長バイト列の読み取り処理。読み取りに成功した場合読み取った値と読み進めたバイト数を返します
-func readVarint(b []byte) (v uint64, n int, err error) {
-	// little endian で読み取っていく
-	for shift := uint(0); ; shift += 7 {
-		// 値を詰める変数vはuint64なので、shiftする値が64bitこえたらoverflow
-		if shift >= 64 {
-			return 0, 0, fmt.Errorf(
-				"the value of varint is up to 64 bits, but the upper 7 bits tried %d bits left shift",
-				shift,
-			)
-		}
-		// 対象のbyteの下位7bitを読み取ってvにつめていく
-		target := b[n]
-		n++
-		v |= uint64(target&0x7F) << shift
-		// 最上位bitが0だったら終端なのでよみとり終了
-		if target < 0x80 {
-			break
-		}
-	}
-	return v, n, nil
-}
@@ -1,11 +1,15 @@
 package protowire
 
 import (
+	"errors"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/convto/protowire/testdata"
 	"github.com/golang/protobuf/proto"
+	wire "google.golang.org/protobuf/encoding/protowire"
 )
 
 func TestUnmarshal(t *testing.T) {
@@ -128,6 +132,46 @@ func TestUnmarshal(t *testing.T) {
 		TestLengthDelimited []*testLengthDelimited `protowire:"6,2,embed,repeated"`
 	}
 
+	type testEmbeddedHeader struct {
+		Int32 int32 `protowire:"1,0,int32,optional"`
+	}
+	type TestEmbeddedPointer struct {
+		Int64 int64 `protowire:"2,0,int64,optional"`
+	}
+	type testEmbeddedStruct struct {
+		testEmbeddedHeader
+		*TestEmbeddedPointer
+		Boolean bool `protowire:"3,0,bool,optional"`
+	}
+	testEmbeddedStructBin, _ := proto.Marshal(&testdata.TestVarint{
+		Int32:   12345,
+		Int64:   67890,
+		Boolean: true,
+	})
+	testEmbeddedHeaderBin, _ := proto.Marshal(&testdata.TestVarint{
+		Int32:   12345,
+		Boolean: true,
+	})
+
+	type testShorthand struct {
+		Int64   []int64                `protowire:"1"`
+		Fixed64 []uint64               `protowire:"2,fixed64"`
+		Fixed32 []uint32               `protowire:"3,fixed32"`
+		Str     []string               `protowire:"4"`
+		Bytes   [][]byte               `protowire:"5"`
+		Embed   []*testLengthDelimited `protowire:"6"`
+	}
+	testShorthandBin, _ := proto.Marshal(&testdata.TestRepeated{
+		Int64:   []int64{12345, -67890},
+		Fixed64: []uint64{12345},
+		Fixed32: []uint32{67890},
+		Str:     []string{"this is test"},
+		Bytes:   [][]byte{{0x00, 0x11}},
+		TestLengthDelimited: []*testdata.TestLengthDelimited{
+			{Str: "🐛"},
+		},
+	})
+
 	testOneOfBin, _ := proto.Marshal(&testdata.TestOneOf{
 		Name: "test oneof",
 		TestIdentifier: &testdata.TestOneOf_Id{
@@ -273,6 +317,52 @@ func TestUnmarshal(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "埋め込みstructのフィールドに値を読み取れる",
+			args: args{
+				b: testEmbeddedStructBin,
+				v: &testEmbeddedStruct{},
+			},
+			want: &testEmbeddedStruct{
+				testEmbeddedHeader: testEmbeddedHeader{
+					Int32: 12345,
+				},
+				TestEmbeddedPointer: &TestEmbeddedPointer{
+					Int64: 67890,
+				},
+				Boolean: true,
+			},
+		},
+		{
+			name: "ポインタで埋め込まれたstructのフィールドが含まれていなければnilのまま",
+			args: args{
+				b: testEmbeddedHeaderBin,
+				v: &testEmbeddedStruct{},
+			},
+			want: &testEmbeddedStruct{
+				testEmbeddedHeader: testEmbeddedHeader{
+					Int32: 12345,
+				},
+				Boolean: true,
+			},
+		},
+		{
+			name: "省略形のタグでも値を読み取れる",
+			args: args{
+				b: testShorthandBin,
+				v: &testShorthand{},
+			},
+			want: &testShorthand{
+				Int64:   []int64{12345, -67890},
+				Fixed64: []uint64{12345},
+				Fixed32: []uint32{67890},
+				Str:     []string{"this is test"},
+				Bytes:   [][]byte{{0x00, 0x11}},
+				Embed: []*testLengthDelimited{
+					{Str: "🐛"},
+				},
+			},
+		},
 		{
 			name: "oneofの検証バイナリ",
 			args: args{
@@ -301,3 +391,578 @@ func TestUnmarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestUnmarshalOptions_Unmarshal_required(t *testing.T) {
+	type requiredChild struct {
+		Int32 int32 `protowire:"1,0,int32,required"`
+		Int64 int64 `protowire:"2,0,int64,required"`
+	}
+	type optionalChild struct {
+		Str string `protowire:"1,2,string,optional"`
+	}
+	type requiredParent struct {
+		Child           *requiredChild `protowire:"1,2,embed,required"`
+		LengthDelimited *optionalChild `protowire:"num=2,type=embed,name=length_delimited,required"`
+	}
+	partialBin, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{
+			Int32: 12345,
+		},
+	})
+	completeBin, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{
+			Int32: 12345,
+			Int64: 67890,
+		},
+		EmbedLengthDelimited: &testdata.TestLengthDelimited{},
+	})
+
+	tests := []struct {
+		name      string
+		opts      UnmarshalOptions
+		b         []byte
+		wantPaths []string
+		wantErr   bool
+	}{
+		{
+			name: "requiredなフィールドがすべて含まれていればエラーにならない",
+			b:    completeBin,
+		},
+		{
+			name:      "requiredなフィールドが含まれていなければ埋め込みメッセージも含めてパスを返す",
+			b:         partialBin,
+			wantPaths: []string{"Child.Int64", "length_delimited"},
+			wantErr:   true,
+		},
+		{
+			name: "AllowPartialが指定されていればエラーにしない",
+			opts: UnmarshalOptions{AllowPartial: true},
+			b:    partialBin,
+		},
+		{
+			name: "埋め込みメッセージが複数回に分かれて現れた場合はマージしたメッセージで判断する",
+			b: []byte{
+				0x0a, 0x02, 0x08, 0x01, // Child{Int32: 1}
+				0x0a, 0x02, 0x10, 0x02, // Child{Int64: 2}
+				0x12, 0x00, // length_delimited{}
+			},
+		},
+		{
+			name: "repeatedでない埋め込みメッセージの後の出現で足りないフィールドも報告する",
+			b: []byte{
+				0x0a, 0x02, 0x10, 0x02, // Child{Int64: 2}
+				0x0a, 0x00, // Child{}
+				0x12, 0x00, // length_delimited{}
+			},
+			wantPaths: []string{"Child.Int32"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Unmarshal(tt.b, &requiredParent{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			var rerr *RequiredNotSetError
+			if !errors.As(err, &rerr) {
+				t.Fatalf("Unmarshal() error = %v, want *RequiredNotSetError", err)
+			}
+			if !reflect.DeepEqual(rerr.Paths, tt.wantPaths) {
+				t.Errorf("Unmarshal() paths = %v, want %v", rerr.Paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+type testRequiredOneOf struct {
+	Kind isTestRequiredOneOf_Kind `protowire_oneof:"kind"`
+}
+
+type isTestRequiredOneOf_Kind interface {
+	isTestRequiredOneOfKind()
+}
+
+type TestRequiredOneOfChild struct {
+	Int32 int32 `protowire:"1,0,int32,required"`
+}
+
+type TestRequiredOneOf_Embed struct {
+	Embed *TestRequiredOneOfChild `protowire:"1,2,embed,oneof"`
+}
+
+func (*TestRequiredOneOf_Embed) isTestRequiredOneOfKind() {}
+
+type TestRequiredOneOf_Sint64 struct {
+	Sint64 int64 `protowire:"2,0,sint64,oneof"`
+}
+
+func (*TestRequiredOneOf_Sint64) isTestRequiredOneOfKind() {}
+
+func TestUnmarshalOptions_Unmarshal_requiredOneOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		b         []byte
+		want      *testRequiredOneOf
+		wantPaths []string
+	}{
+		{
+			name: "後から別の実装に置き換えられたoneofのメンバーのrequiredなフィールドは報告しない",
+			b: []byte{
+				0x0a, 0x00, // Embed{}
+				0x10, 0x02, // Sint64: 1
+			},
+			want: &testRequiredOneOf{Kind: &TestRequiredOneOf_Sint64{Sint64: 1}},
+		},
+		{
+			name: "最後にSetされたoneofのメンバーのrequiredなフィールドは報告する",
+			b: []byte{
+				0x10, 0x02, // Sint64: 1
+				0x0a, 0x00, // Embed{}
+			},
+			want:      &testRequiredOneOf{Kind: &TestRequiredOneOf_Embed{Embed: &TestRequiredOneOfChild{}}},
+			wantPaths: []string{"Embed.Int32"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &testRequiredOneOf{}
+			err := Unmarshal(tt.b, got)
+			if tt.wantPaths == nil {
+				if err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+			} else {
+				var rerr *RequiredNotSetError
+				if !errors.As(err, &rerr) {
+					t.Fatalf("Unmarshal() error = %v, want *RequiredNotSetError", err)
+				}
+				if !reflect.DeepEqual(rerr.Paths, tt.wantPaths) {
+					t.Errorf("Unmarshal() paths = %v, want %v", rerr.Paths, tt.wantPaths)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalOptions_Unmarshal_checkRange(t *testing.T) {
+	// int64として送信された値を、スキーマを変更してint32として受信するケースを想定する
+	type narrowed struct {
+		Int32 int32 `protowire:"2,0,int32,optional"`
+	}
+	type narrowedUint struct {
+		Uint32 uint32 `protowire:"2,0,uint32,optional"`
+	}
+	type narrowedEnum struct {
+		Enum int32 `protowire:"2,0,enum,optional"`
+	}
+	type narrowedSint struct {
+		Sint32 int32 `protowire:"2,0,sint32,optional"`
+	}
+	marshal := func(i int64) []byte {
+		b, _ := proto.Marshal(&testdata.TestVarint{Int64: i})
+		return b
+	}
+	// marshalSint はsint64として送信された値をzigzag encodingしたバイナリを返します
+	marshalSint := func(i int64) []byte {
+		return wire.AppendVarint(wire.AppendTag(nil, 2, wire.VarintType), wire.EncodeZigZag(i))
+	}
+
+	tests := []struct {
+		name      string
+		b         []byte
+		v         interface{}
+		truncated interface{}
+		wantErr   bool
+		wantPath  string
+	}{
+		{
+			name:      "int32に収まる値は読み取れる",
+			b:         marshal(math.MaxInt32),
+			v:         &narrowed{},
+			truncated: &narrowed{Int32: math.MaxInt32},
+		},
+		{
+			name:      "int32に収まる負の値は読み取れる",
+			b:         marshal(math.MinInt32),
+			v:         &narrowed{},
+			truncated: &narrowed{Int32: math.MinInt32},
+		},
+		{
+			name:      "int32の最大値を超える値は範囲外",
+			b:         marshal(math.MaxInt32 + 1),
+			v:         &narrowed{},
+			truncated: &narrowed{Int32: math.MinInt32},
+			wantErr:   true,
+			wantPath:  "Int32",
+		},
+		{
+			name:      "int32の最小値を下回る値は範囲外",
+			b:         marshal(math.MinInt32 - 1),
+			v:         &narrowed{},
+			truncated: &narrowed{Int32: math.MaxInt32},
+			wantErr:   true,
+			wantPath:  "Int32",
+		},
+		{
+			name:      "uint32の最大値を超える値は範囲外",
+			b:         marshal(math.MaxUint32 + 1),
+			v:         &narrowedUint{},
+			truncated: &narrowedUint{Uint32: 0},
+			wantErr:   true,
+			wantPath:  "Uint32",
+		},
+		{
+			name:      "sint32に収まる値はzigzag decodeして読み取れる",
+			b:         marshalSint(math.MaxInt32),
+			v:         &narrowedSint{},
+			truncated: &narrowedSint{Sint32: math.MaxInt32},
+		},
+		{
+			name:      "sint32に収まる負の値はzigzag decodeして読み取れる",
+			b:         marshalSint(math.MinInt32),
+			v:         &narrowedSint{},
+			truncated: &narrowedSint{Sint32: math.MinInt32},
+		},
+		{
+			name:      "sint32の最大値を超える値は範囲外",
+			b:         marshalSint(math.MaxInt32 + 1),
+			v:         &narrowedSint{},
+			truncated: &narrowedSint{Sint32: 0},
+			wantErr:   true,
+			wantPath:  "Sint32",
+		},
+		{
+			name:      "sint32の最小値を下回る値は範囲外",
+			b:         marshalSint(math.MinInt32 - 1),
+			v:         &narrowedSint{},
+			truncated: &narrowedSint{Sint32: -1},
+			wantErr:   true,
+			wantPath:  "Sint32",
+		},
+		{
+			name:      "enumもint32と同じく範囲を検証する",
+			b:         marshal(1 << 40),
+			v:         &narrowedEnum{},
+			truncated: &narrowedEnum{Enum: 0},
+			wantErr:   true,
+			wantPath:  "Enum",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// デフォルトでは仕様通り切り捨てて読み取る
+			if err := Unmarshal(tt.b, tt.v); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.v, tt.truncated) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", tt.v, tt.truncated)
+			}
+
+			err := UnmarshalOptions{CheckRange: true}.Unmarshal(tt.b, tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			var rerr *RangeError
+			if !errors.As(err, &rerr) {
+				t.Fatalf("Unmarshal() error = %v, want *RangeError", err)
+			}
+			if rerr.Path != tt.wantPath {
+				t.Errorf("Unmarshal() RangeError.Path = %s, want %s", rerr.Path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestUnmarshalOptions_Unmarshal_utf8(t *testing.T) {
+	type utf8Child struct {
+		Str string `protowire:"1,2,string,optional"`
+	}
+	type utf8Message struct {
+		Str      string     `protowire:"1,2,string,optional"`
+		Repeated []string   `protowire:"2,2,string,repeated"`
+		Child    *utf8Child `protowire:"3,2,embed,optional"`
+		Proto2   string     `protowire:"4,2,string,optional,noutf8"`
+	}
+	invalid := string([]byte{0xff, 0xfe})
+	str := func(fn wire.Number, s string) []byte {
+		return wire.AppendString(wire.AppendTag(nil, fn, wire.BytesType), s)
+	}
+
+	tests := []struct {
+		name     string
+		opts     UnmarshalOptions
+		b        []byte
+		v        interface{}
+		wantPath string
+	}{
+		{
+			name: "正しいUTF-8は読み取れる",
+			b:    str(1, "こんにちは"),
+			v:    &utf8Message{},
+		},
+		{
+			name:     "不正なUTF-8はエラー",
+			b:        str(1, invalid),
+			v:        &utf8Message{},
+			wantPath: "Str",
+		},
+		{
+			name:     "repeatedの要素も検証する",
+			b:        append(str(2, "a"), str(2, invalid)...),
+			v:        &utf8Message{},
+			wantPath: "Repeated",
+		},
+		{
+			name:     "埋め込みメッセージのフィールドはパスで報告される",
+			b:        wire.AppendBytes(wire.AppendTag(nil, 3, wire.BytesType), str(1, invalid)),
+			v:        &utf8Message{},
+			wantPath: "Child.Str",
+		},
+		{
+			name:     "oneofのフィールドも検証する",
+			b:        str(2, invalid),
+			v:        &testOneOf{},
+			wantPath: "Id",
+		},
+		{
+			name: "noutf8が指定されたフィールドは検証しない",
+			b:    str(4, invalid),
+			v:    &utf8Message{},
+		},
+		{
+			name: "AllowInvalidUTF8を指定すると検証しない",
+			opts: UnmarshalOptions{AllowInvalidUTF8: true},
+			b:    str(1, invalid),
+			v:    &utf8Message{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Unmarshal(tt.b, tt.v)
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				return
+			}
+			var uerr *InvalidUTF8Error
+			if !errors.As(err, &uerr) {
+				t.Fatalf("Unmarshal() error = %v, want *InvalidUTF8Error", err)
+			}
+			if uerr.Path != tt.wantPath {
+				t.Errorf("Unmarshal() InvalidUTF8Error.Path = %s, want %s", uerr.Path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestUnmarshalOptions_Unmarshal_alias(t *testing.T) {
+	type aliasMessage struct {
+		Str   string `protowire:"1,2,string,optional"`
+		Bytes []byte `protowire:"2,2,bytes,optional"`
+	}
+	newBytes := func() []byte {
+		b := wire.AppendString(wire.AppendTag(nil, 1, wire.BytesType), "abc")
+		return wire.AppendBytes(wire.AppendTag(b, 2, wire.BytesType), []byte("def"))
+	}
+	// 入力のバイト列を書き換える
+	overwrite := func(b []byte) {
+		for i := range b {
+			b[i] = 'x'
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts UnmarshalOptions
+		want *aliasMessage
+	}{
+		{
+			name: "デフォルトではコピーするので入力のバイト列を書き換えても影響しない",
+			want: &aliasMessage{Str: "abc", Bytes: []byte("def")},
+		},
+		{
+			name: "Aliasを指定すると入力のバイト列を参照する",
+			opts: UnmarshalOptions{Alias: true},
+			want: &aliasMessage{Str: "xxx", Bytes: []byte("xxx")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBytes()
+			v := &aliasMessage{}
+			if err := tt.opts.Unmarshal(b, v); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			overwrite(b)
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_packed(t *testing.T) {
+	type packedDeclared struct {
+		Int32    []int32   `protowire:"1,2,int32,packed,repeated"`
+		Int64    []int64   `protowire:"2,2,int64,packed,repeated"`
+		Uint32   []uint32  `protowire:"3,2,uint32,packed,repeated"`
+		Uint64   []uint64  `protowire:"4,2,uint64,packed,repeated"`
+		Sint32   []int32   `protowire:"5,2,sint32,packed,repeated"`
+		Sint64   []int64   `protowire:"6,2,sint64,packed,repeated"`
+		Bool     []bool    `protowire:"7,2,bool,packed,repeated"`
+		Enum     []int32   `protowire:"8,2,enum,packed,repeated"`
+		Fixed32  []uint32  `protowire:"9,2,fixed32,packed,repeated"`
+		Sfixed32 []int32   `protowire:"10,2,sfixed32,packed,repeated"`
+		Float    []float32 `protowire:"11,2,float,packed,repeated"`
+		Fixed64  []uint64  `protowire:"12,2,fixed64,packed,repeated"`
+		Sfixed64 []int64   `protowire:"13,2,sfixed64,packed,repeated"`
+		Double   []float64 `protowire:"14,2,double,packed,repeated"`
+	}
+	type unpackedDeclared struct {
+		Int32    []int32   `protowire:"1,0,int32,repeated"`
+		Int64    []int64   `protowire:"2,0,int64,repeated"`
+		Uint32   []uint32  `protowire:"3,0,uint32,repeated"`
+		Uint64   []uint64  `protowire:"4,0,uint64,repeated"`
+		Sint32   []int32   `protowire:"5,0,sint32,repeated"`
+		Sint64   []int64   `protowire:"6,0,sint64,repeated"`
+		Bool     []bool    `protowire:"7,0,bool,repeated"`
+		Enum     []int32   `protowire:"8,0,enum,repeated"`
+		Fixed32  []uint32  `protowire:"9,5,fixed32,repeated"`
+		Sfixed32 []int32   `protowire:"10,5,sfixed32,repeated"`
+		Float    []float32 `protowire:"11,5,float,repeated"`
+		Fixed64  []uint64  `protowire:"12,1,fixed64,repeated"`
+		Sfixed64 []int64   `protowire:"13,1,sfixed64,repeated"`
+		Double   []float64 `protowire:"14,1,double,repeated"`
+	}
+
+	n12345, n67890 := int64(-12345), int64(-67890)
+	// values はfield numberごとに、wireバイナリ上の値をエンコードする関数の一覧です
+	values := []struct {
+		wt     wire.Type
+		encode []func([]byte) []byte
+	}{
+		{wire.VarintType, []func([]byte) []byte{varintOf(uint64(12345)), varintOf(uint64(n12345))}},
+		{wire.VarintType, []func([]byte) []byte{varintOf(67890), varintOf(uint64(n67890))}},
+		{wire.VarintType, []func([]byte) []byte{varintOf(12345), varintOf(math.MaxUint32)}},
+		{wire.VarintType, []func([]byte) []byte{varintOf(67890), varintOf(math.MaxUint64)}},
+		{wire.VarintType, []func([]byte) []byte{varintOf(wire.EncodeZigZag(12345)), varintOf(wire.EncodeZigZag(-12345))}},
+		{wire.VarintType, []func([]byte) []byte{varintOf(wire.EncodeZigZag(67890)), varintOf(wire.EncodeZigZag(-67890))}},
+		{wire.VarintType, []func([]byte) []byte{varintOf(1), varintOf(0)}},
+		{wire.VarintType, []func([]byte) []byte{varintOf(1), varintOf(2)}},
+		{wire.Fixed32Type, []func([]byte) []byte{fixed32Of(12345), fixed32Of(67890)}},
+		{wire.Fixed32Type, []func([]byte) []byte{fixed32Of(uint32(n12345)), fixed32Of(67890)}},
+		{wire.Fixed32Type, []func([]byte) []byte{fixed32Of(math.Float32bits(1.5)), fixed32Of(math.Float32bits(-2.5))}},
+		{wire.Fixed64Type, []func([]byte) []byte{fixed64Of(12345), fixed64Of(67890)}},
+		{wire.Fixed64Type, []func([]byte) []byte{fixed64Of(uint64(n12345)), fixed64Of(67890)}},
+		{wire.Fixed64Type, []func([]byte) []byte{fixed64Of(math.Float64bits(1.5)), fixed64Of(math.Float64bits(-2.5))}},
+	}
+	var packedBin, unpackedBin []byte
+	for i, v := range values {
+		num := wire.Number(i + 1)
+		var packed []byte
+		for _, encode := range v.encode {
+			packed = encode(packed)
+			unpackedBin = encode(wire.AppendTag(unpackedBin, num, v.wt))
+		}
+		packedBin = wire.AppendBytes(wire.AppendTag(packedBin, num, wire.BytesType), packed)
+	}
+
+	wantPacked := &packedDeclared{
+		Int32:    []int32{12345, -12345},
+		Int64:    []int64{67890, -67890},
+		Uint32:   []uint32{12345, math.MaxUint32},
+		Uint64:   []uint64{67890, math.MaxUint64},
+		Sint32:   []int32{12345, -12345},
+		Sint64:   []int64{67890, -67890},
+		Bool:     []bool{true, false},
+		Enum:     []int32{1, 2},
+		Fixed32:  []uint32{12345, 67890},
+		Sfixed32: []int32{-12345, 67890},
+		Float:    []float32{1.5, -2.5},
+		Fixed64:  []uint64{12345, 67890},
+		Sfixed64: []int64{-12345, 67890},
+		Double:   []float64{1.5, -2.5},
+	}
+	wantUnpacked := &unpackedDeclared{}
+	reflect.ValueOf(wantUnpacked).Elem().Set(reflect.ValueOf(wantPacked).Elem().Convert(reflect.TypeOf(unpackedDeclared{})))
+
+	tests := []struct {
+		name string
+		b    []byte
+		v    interface{}
+		want interface{}
+	}{
+		{
+			name: "packedとして宣言されたフィールドでpackedなバイナリを読み取れる",
+			b:    packedBin,
+			v:    &packedDeclared{},
+			want: wantPacked,
+		},
+		{
+			name: "packedとして宣言されたフィールドでunpackedなバイナリを読み取れる",
+			b:    unpackedBin,
+			v:    &packedDeclared{},
+			want: wantPacked,
+		},
+		{
+			name: "packedとして宣言されていないフィールドでpackedなバイナリを読み取れる",
+			b:    packedBin,
+			v:    &unpackedDeclared{},
+			want: wantUnpacked,
+		},
+		{
+			name: "packedとして宣言されていないフィールドでunpackedなバイナリを読み取れる",
+			b:    unpackedBin,
+			v:    &unpackedDeclared{},
+			want: wantUnpacked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Unmarshal(tt.b, tt.v); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.v, tt.want) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", tt.v, tt.want)
+			}
+		})
+	}
+}
+
+func varintOf(v uint64) func([]byte) []byte {
+	return func(b []byte) []byte { return wire.AppendVarint(b, v) }
+}
+
+func fixed32Of(v uint32) func([]byte) []byte {
+	return func(b []byte) []byte { return wire.AppendFixed32(b, v) }
+}
+
+func fixed64Of(v uint64) func([]byte) []byte {
+	return func(b []byte) []byte { return wire.AppendFixed64(b, v) }
+}
+
+func TestUnmarshal_wrongWireType(t *testing.T) {
+	// タグのwire typeは2だが、比較に使うのはproto typeから求めたwire typeなので、エラーにもそれを表示する
+	type packedInt32 struct {
+		Int32 []int32 `protowire:"1,2,int32,packed,repeated"`
+	}
+	b := []byte{0x0d, 0x01, 0x00, 0x00, 0x00} // field 1, fixed32
+	err := Unmarshal(b, &packedInt32{})
+	if err == nil {
+		t.Fatal("Unmarshal() error = nil, want wrong wire type error")
+	}
+	if want := "expected wire type for proto type int32: 0, binary wire type: 5"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Unmarshal() error = %v, want containing %q", err, want)
+	}
+}
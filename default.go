@@ -0,0 +1,226 @@
+package protowire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// enumRegistry はenumのGoの型ごとに、 RegisterEnum で登録された値の名前と数値の対応を保持します
+var enumRegistry = struct {
+	sync.RWMutex
+	m map[reflect.Type]map[string]int32
+}{
+	m: make(map[reflect.Type]map[string]int32),
+}
+
+// RegisterEnum はenumのGoの型 enumType に、値の名前と数値の対応 values を登録します
+// 登録したenumのフィールドでは、proto2の `[default = NAME]` と同じく `def=` に値の名前を指定できます
+// values にはprotoc-gen-goが生成する `<Enum>_value` をそのまま渡せます
+//
+//	protowire.RegisterEnum(Color(0), Color_value)
+func RegisterEnum(enumType interface{}, values map[string]int32) error {
+	rt := reflect.TypeOf(enumType)
+	if rt == nil || rt.Kind() != reflect.Int32 {
+		return fmt.Errorf("enum type must be int32 kind, but %v", rt)
+	}
+	enumRegistry.Lock()
+	defer enumRegistry.Unlock()
+	if _, ok := enumRegistry.m[rt]; ok {
+		return fmt.Errorf("enum %s is already registered", rt.String())
+	}
+	m := make(map[string]int32, len(values))
+	for name, v := range values {
+		m[name] = v
+	}
+	enumRegistry.m[rt] = m
+	return nil
+}
+
+// lookupEnumValue は RegisterEnum で登録されたenumの値の名前から数値を探します
+func lookupEnumValue(rt reflect.Type, name string) (int32, bool) {
+	enumRegistry.RLock()
+	defer enumRegistry.RUnlock()
+	v, ok := enumRegistry.m[rt][name]
+	return v, ok
+}
+
+// ResetToDefaults は v をゼロ値にしたうえで、タグの `def=` で指定されたデフォルト値を各フィールドにSetします
+func ResetToDefaults(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("target value must be a non-nil pointer")
+	}
+	rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	pm, err := newProtoMetadata(v)
+	if err != nil {
+		return fmt.Errorf("failed to parse protoMetadata from input interface{}: %w", err)
+	}
+	for _, fm := range pm.fields {
+		if !fm.def.IsValid() {
+			continue
+		}
+		// nilのポインタで埋め込まれたstructは、デフォルト値を持つフィールドがある場合だけ割り当てます
+		if err := fm.embed.alloc(); err != nil {
+			return fmt.Errorf("failed to set default value of %s: %w", fm.label(), err)
+		}
+		fm.setDefault()
+	}
+	return nil
+}
+
+// setDefault はデフォルト値が指定されていれば rv にSetします
+// bytesのデフォルト値は呼び出し元で書き換えられても影響しないようにコピーしてSetします
+func (fm protoFieldMetadata) setDefault() {
+	if !fm.def.IsValid() {
+		return
+	}
+	if fm.pt == protoBytes {
+		fm.rv.SetBytes(append([]byte(nil), fm.def.Bytes()...))
+		return
+	}
+	fm.rv.Set(fm.def)
+}
+
+// parseDefault はタグで指定されたデフォルト値の文字列を proto type に従って解釈し、 rt 型の値として返します
+// protocが出力するデフォルト値と同じく、浮動小数点数はinf, -inf, nanを、bytesはCのエスケープシーケンスを受け付けます
+// enumのデフォルト値は数値か、 RegisterEnum で登録した値の名前で指定します
+func parseDefault(pt protoType, rt reflect.Type, s string) (reflect.Value, error) {
+	if isRepeatedType(rt) {
+		return reflect.Value{}, errors.New("default value can not be set to repeated field")
+	}
+	if !pt.matchGoType(rt) {
+		return reflect.Value{}, fmt.Errorf("proto type %s can not be bound to %s", pt, rt.String())
+	}
+	rv := reflect.New(rt).Elem()
+	switch pt {
+	case protoEnum:
+		i, err := strconv.ParseInt(s, 10, 32)
+		if err == nil {
+			rv.SetInt(i)
+			break
+		}
+		v, ok := lookupEnumValue(rt, s)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("invalid default value of enum %s: %s is neither a number nor a name registered by RegisterEnum", rt.String(), s)
+		}
+		rv.SetInt(int64(v))
+	case protoInt32, protoSint32, protoSfixed32:
+		i, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid default value of %s: %w", pt, err)
+		}
+		rv.SetInt(i)
+	case protoInt64, protoSint64, protoSfixed64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid default value of %s: %w", pt, err)
+		}
+		rv.SetInt(i)
+	case protoUint32, protoFixed32:
+		u, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid default value of %s: %w", pt, err)
+		}
+		rv.SetUint(u)
+	case protoUint64, protoFixed64:
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid default value of %s: %w", pt, err)
+		}
+		rv.SetUint(u)
+	case protoBool:
+		switch s {
+		case "true":
+			rv.SetBool(true)
+		case "false":
+		default:
+			return reflect.Value{}, fmt.Errorf("invalid default value of bool: %s", s)
+		}
+	case protoFloat, protoDouble:
+		bitSize := 64
+		if pt == protoFloat {
+			bitSize = 32
+		}
+		f, err := strconv.ParseFloat(s, bitSize)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid default value of %s: %w", pt, err)
+		}
+		rv.SetFloat(f)
+	case protoString:
+		rv.SetString(s)
+	case protoBytes:
+		b, err := unescapeBytes(s)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid default value of bytes: %w", err)
+		}
+		rv.SetBytes(b)
+	default:
+		return reflect.Value{}, fmt.Errorf("default value can not be set to proto type %s", pt)
+	}
+	return rv, nil
+}
+
+// unescapeBytes はprotocがbytesのデフォルト値を表現するときに使うCのエスケープシーケンスを解釈します
+// e.g. `\001\377`, `\x01`, `\n`
+func unescapeBytes(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return nil, errors.New("unexpected end of escape sequence")
+		}
+		switch c := s[i]; c {
+		case 'a':
+			b = append(b, '\a')
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'v':
+			b = append(b, '\v')
+		case '\\', '\'', '"', '?':
+			b = append(b, c)
+		case 'x', 'X':
+			// 16進数は最大2桁まで読み取ります
+			j := i + 1
+			for j < len(s) && j < i+3 && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("invalid hex escape at %d", i)
+			}
+			v, _ := strconv.ParseUint(s[i+1:j], 16, 8)
+			b = append(b, byte(v))
+			i = j - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// 8進数は最大3桁まで読み取ります
+			j := i
+			for j < len(s) && j < i+3 && '0' <= s[j] && s[j] <= '7' {
+				j++
+			}
+			v, err := strconv.ParseUint(s[i:j], 8, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid octal escape at %d: %w", i, err)
+			}
+			b = append(b, byte(v))
+			i = j - 1
+		default:
+			return nil, fmt.Errorf("unknown escape sequence \\%c", c)
+		}
+	}
+	return b, nil
+}
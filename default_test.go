@@ -0,0 +1,225 @@
+package protowire
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+)
+
+type testDefault struct {
+	Int32   int32   `protowire:"1,0,int32,optional,def=-12345"`
+	Int64   int64   `protowire:"2,0,int64,optional,def=67890"`
+	Boolean bool    `protowire:"3,0,bool,optional,def=true"`
+	Str     string  `protowire:"4,2,string,optional,def=hello, world"`
+	Bytes   []byte  `protowire:"5,2,bytes,optional,def=\\001\\377\\x10a"`
+	Double  float64 `protowire:"6,1,double,optional,def=-inf"`
+	Enum    int32   `protowire:"7,0,enum,optional,def=2"`
+	NoDef   uint32  `protowire:"8,0,uint32,optional"`
+}
+
+func TestUnmarshal_default(t *testing.T) {
+	bin, _ := proto.Marshal(&testdata.TestVarint{
+		Int32: 1,
+	})
+
+	tests := []struct {
+		name string
+		opts UnmarshalOptions
+		v    *testDefault
+		want *testDefault
+	}{
+		{
+			name: "バイト列に含まれていないフィールドにはデフォルト値が適用される",
+			v:    &testDefault{},
+			want: &testDefault{
+				Int32:   1,
+				Int64:   67890,
+				Boolean: true,
+				Str:     "hello, world",
+				Bytes:   []byte{0x01, 0xFF, 0x10, 'a'},
+				Double:  math.Inf(-1),
+				Enum:    2,
+			},
+		},
+		{
+			name: "マージする場合はすでに値がSetされているフィールドはその値を優先する",
+			opts: UnmarshalOptions{Merge: true},
+			v: &testDefault{
+				Int64: 1,
+			},
+			want: &testDefault{
+				Int32:   1,
+				Int64:   1,
+				Boolean: true,
+				Str:     "hello, world",
+				Bytes:   []byte{0x01, 0xFF, 0x10, 'a'},
+				Double:  math.Inf(-1),
+				Enum:    2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Unmarshal(bin, tt.v); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.v, tt.want) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", tt.v, tt.want)
+			}
+		})
+	}
+}
+
+func TestResetToDefaults(t *testing.T) {
+	v := &testDefault{
+		Int32: 1,
+		NoDef: 2,
+	}
+	if err := ResetToDefaults(v); err != nil {
+		t.Fatalf("ResetToDefaults() error = %v", err)
+	}
+	want := &testDefault{
+		Int32:   -12345,
+		Int64:   67890,
+		Boolean: true,
+		Str:     "hello, world",
+		Bytes:   []byte{0x01, 0xFF, 0x10, 'a'},
+		Double:  math.Inf(-1),
+		Enum:    2,
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("ResetToDefaults() got = %+v, want %+v", v, want)
+	}
+}
+
+type testDefaultEnum int32
+
+func Test_parseDefault(t *testing.T) {
+	if err := RegisterEnum(testDefaultEnum(0), map[string]int32{"FOO": 1, "BAR": 2}); err != nil {
+		t.Fatalf("RegisterEnum() error = %v", err)
+	}
+	if err := RegisterEnum(testDefaultEnum(0), nil); err == nil {
+		t.Errorf("RegisterEnum() error = nil, want error for duplicate registration")
+	}
+	t.Cleanup(func() {
+		enumRegistry.Lock()
+		delete(enumRegistry.m, reflect.TypeOf(testDefaultEnum(0)))
+		enumRegistry.Unlock()
+	})
+
+	tests := []struct {
+		name    string
+		pt      protoType
+		rt      reflect.Type
+		s       string
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "floatのnanを読み取れる",
+			pt:   protoFloat,
+			rt:   reflect.TypeOf(float32(0)),
+			s:    "nan",
+		},
+		{
+			name: "doubleのinfを読み取れる",
+			pt:   protoDouble,
+			rt:   reflect.TypeOf(float64(0)),
+			s:    "inf",
+			want: math.Inf(1),
+		},
+		{
+			name: "uint64の最大値を読み取れる",
+			pt:   protoFixed64,
+			rt:   reflect.TypeOf(uint64(0)),
+			s:    "18446744073709551615",
+			want: uint64(math.MaxUint64),
+		},
+		{
+			name: "bytesのエスケープシーケンスを読み取れる",
+			pt:   protoBytes,
+			rt:   reflect.TypeOf([]byte(nil)),
+			s:    `\n\"\\\0`,
+			want: []byte{'\n', '"', '\\', 0x00},
+		},
+		{
+			name: "RegisterEnumで登録したenumの値の名前を読み取れる",
+			pt:   protoEnum,
+			rt:   reflect.TypeOf(testDefaultEnum(0)),
+			s:    "BAR",
+			want: testDefaultEnum(2),
+		},
+		{
+			name: "enumは数値でも指定できる",
+			pt:   protoEnum,
+			rt:   reflect.TypeOf(testDefaultEnum(0)),
+			s:    "1",
+			want: testDefaultEnum(1),
+		},
+		{
+			name:    "登録されていないenumの値の名前はエラー",
+			pt:      protoEnum,
+			rt:      reflect.TypeOf(testDefaultEnum(0)),
+			s:       "BAZ",
+			wantErr: true,
+		},
+		{
+			name:    "RegisterEnumで登録していないenumの型では名前を指定できない",
+			pt:      protoEnum,
+			rt:      reflect.TypeOf(int32(0)),
+			s:       "FOO",
+			wantErr: true,
+		},
+		{
+			name:    "int32の範囲を超えるとエラー",
+			pt:      protoInt32,
+			rt:      reflect.TypeOf(int32(0)),
+			s:       "2147483648",
+			wantErr: true,
+		},
+		{
+			name:    "boolはtrueかfalseでなければエラー",
+			pt:      protoBool,
+			rt:      reflect.TypeOf(false),
+			s:       "1",
+			wantErr: true,
+		},
+		{
+			name:    "repeatedなフィールドにはデフォルト値を指定できない",
+			pt:      protoInt32,
+			rt:      reflect.TypeOf([]int32(nil)),
+			s:       "1",
+			wantErr: true,
+		},
+		{
+			name:    "Goの型とproto typeが一致しないとエラー",
+			pt:      protoInt32,
+			rt:      reflect.TypeOf(""),
+			s:       "1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDefault(tt.pt, tt.rt, tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDefault() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.want == nil {
+				if f := got.Float(); !math.IsNaN(f) {
+					t.Errorf("parseDefault() got = %v, want NaN", f)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Interface(), tt.want) {
+				t.Errorf("parseDefault() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package protowire
+
+import (
+	"fmt"
+	"io"
+)
+
+// DelimitedReader はそれぞれのメッセージの前にvarintでバイト長が付与されたメッセージの列を読み取ります
+// Javaの writeDelimitedTo / parseDelimitedFrom と同じ形式で、ログファイルやソケットで複数のメッセージを送る場合に利用します
+type DelimitedReader struct {
+	// Options は読み取りの設定で、 UnmarshalOptions.Unmarshal と同じように扱います
+	Options UnmarshalOptions
+	// MaxSize は1つのメッセージとして読み取れる最大のバイト数です。0の場合は DefaultMaxValueSize です
+	// これを超えるメッセージが現れると ErrValueTooLarge を返します
+	MaxSize int
+
+	dec *Decoder
+}
+
+// NewDelimitedReader は r から読み取る DelimitedReader を返します
+func NewDelimitedReader(r io.Reader) *DelimitedReader {
+	return &DelimitedReader{dec: NewDecoder(r)}
+}
+
+// Next は次のメッセージを読み取って v にbindします
+// メッセージの境界で r が終端に達した場合は io.EOF を返し、メッセージの途中で終端に達した場合は io.ErrUnexpectedEOF を返します
+func (dr *DelimitedReader) Next(v interface{}) error {
+	b, err := dr.dec.readVarint(nil)
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read message length: %w", err)
+	}
+	byteLen, _, err := ConsumeVarint(b)
+	if err != nil {
+		return fmt.Errorf("failed to read message length: %w", err)
+	}
+	max := dr.MaxSize
+	if max <= 0 {
+		max = DefaultMaxValueSize
+	}
+	if byteLen > uint64(max) {
+		return fmt.Errorf("%w: %d bytes", ErrValueTooLarge, byteLen)
+	}
+	msg, err := dr.dec.readFull(nil, int(byteLen))
+	if err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+	return dr.Options.Unmarshal(msg, v)
+}
+
+// DelimitedWriter は DelimitedReader で読み取れるように、それぞれのメッセージの前にvarintでバイト長を付与して書き込みます
+type DelimitedWriter struct {
+	w io.Writer
+}
+
+// NewDelimitedWriter は w に書き込む DelimitedWriter を返します
+func NewDelimitedWriter(w io.Writer) *DelimitedWriter {
+	return &DelimitedWriter{w: w}
+}
+
+// WriteMessage はエンコード済みのメッセージ b の前にバイト長を付与して書き込みます
+// このパッケージはエンコードを提供していないので、 b には proto.Marshal などでエンコードしたバイト列を渡します
+func (dw *DelimitedWriter) WriteMessage(b []byte) error {
+	buf := AppendVarint(make([]byte, 0, len(b)+10), uint64(len(b)))
+	if _, err := dw.w.Write(append(buf, b...)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
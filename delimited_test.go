@@ -0,0 +1,124 @@
+package protowire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
+type testDelimited struct {
+	Int32   int32 `protowire:"1,0,int32,optional"`
+	Int64   int64 `protowire:"2,0,int64,optional"`
+	Boolean bool  `protowire:"3,0,bool,optional"`
+}
+
+func TestDelimitedReader_Next(t *testing.T) {
+	first, _ := proto.Marshal(&testdata.TestVarint{Int32: 12345})
+	second, _ := proto.Marshal(&testdata.TestVarint{Int64: 67890, Boolean: true})
+	// Javaの writeDelimitedTo と同じく、メッセージの前にvarintでバイト長を付与する
+	var stream []byte
+	stream = wire.AppendBytes(stream, first)
+	stream = wire.AppendBytes(stream, nil)
+	stream = wire.AppendBytes(stream, second)
+
+	tests := []struct {
+		name    string
+		b       []byte
+		maxSize int
+		want    []*testDelimited
+		wantErr error
+	}{
+		{
+			name: "すべてのメッセージを読み取った後はio.EOFを返す",
+			b:    stream,
+			want: []*testDelimited{
+				{Int32: 12345},
+				{},
+				{Int64: 67890, Boolean: true},
+			},
+			wantErr: io.EOF,
+		},
+		{
+			name:    "空の入力はio.EOFを返す",
+			b:       nil,
+			wantErr: io.EOF,
+		},
+		{
+			name:    "最後のメッセージの途中で終端に達するとio.ErrUnexpectedEOFを返す",
+			b:       stream[:len(stream)-1],
+			want:    []*testDelimited{{Int32: 12345}, {}},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "バイト長の途中で終端に達するとio.ErrUnexpectedEOFを返す",
+			b:       append(append([]byte{}, stream...), 0x80),
+			want:    []*testDelimited{{Int32: 12345}, {}, {Int64: 67890, Boolean: true}},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "MaxSizeを超えるメッセージはエラー",
+			b:       stream,
+			maxSize: 2,
+			wantErr: ErrValueTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dr := NewDelimitedReader(bytes.NewReader(tt.b))
+			dr.MaxSize = tt.maxSize
+			var got []*testDelimited
+			var err error
+			for {
+				v := &testDelimited{}
+				if err = dr.Next(v); err != nil {
+					break
+				}
+				got = append(got, v)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Next() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Next() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelimitedWriter_WriteMessage(t *testing.T) {
+	first, _ := proto.Marshal(&testdata.TestVarint{Int32: 12345})
+	second, _ := proto.Marshal(&testdata.TestVarint{Int64: 1 << 40})
+
+	var buf bytes.Buffer
+	dw := NewDelimitedWriter(&buf)
+	for _, b := range [][]byte{first, second} {
+		if err := dw.WriteMessage(b); err != nil {
+			t.Fatalf("WriteMessage() error = %v", err)
+		}
+	}
+	want := wire.AppendBytes(wire.AppendBytes(nil, first), second)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("WriteMessage() got = %x, want %x", buf.Bytes(), want)
+	}
+
+	// 書き込んだメッセージは DelimitedReader で読み取れる
+	dr := NewDelimitedReader(&buf)
+	for _, want := range []*testDelimited{{Int32: 12345}, {Int64: 1 << 40}} {
+		got := &testDelimited{}
+		if err := dr.Next(got); err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Next() got = %+v, want %+v", got, want)
+		}
+	}
+	if err := dr.Next(&testDelimited{}); err != io.EOF {
+		t.Errorf("Next() error = %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,176 @@
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// VarintValue はint32, int64, uint32, uint64, bool, enumの値として書き込む Value を返します
+// 負のint32, int64は uint64(v) として、sint32, sint64はzigzag encodingした値を渡します
+func VarintValue(v uint64) Value {
+	return Value{occurrences: []valueOccurrence{{wt: WireVarint, raw: AppendVarint(nil, v)}}}
+}
+
+// Fixed32Value はfixed32, sfixed32, floatの値として書き込む Value を返します
+func Fixed32Value(v uint32) Value {
+	raw := make([]byte, 4)
+	binary.LittleEndian.PutUint32(raw, v)
+	return Value{occurrences: []valueOccurrence{{wt: WireFixed32, raw: raw}}}
+}
+
+// Fixed64Value はfixed64, sfixed64, doubleの値として書き込む Value を返します
+func Fixed64Value(v uint64) Value {
+	raw := make([]byte, 8)
+	binary.LittleEndian.PutUint64(raw, v)
+	return Value{occurrences: []valueOccurrence{{wt: WireFixed64, raw: raw}}}
+}
+
+// BytesValue はbytesや埋め込みメッセージの値として書き込む Value を返します
+func BytesValue(b []byte) Value {
+	return Value{occurrences: []valueOccurrence{{wt: WireLengthDelimited, raw: b}}}
+}
+
+// StringValue はstringの値として書き込む Value を返します
+func StringValue(s string) Value {
+	return BytesValue([]byte(s))
+}
+
+// SetField はwireバイナリ b の path のフィールドの値を v に置き換えた新しいバイト列を返します
+// path はfield numberを埋め込みメッセージの外側から順に並べたもので、途中の埋め込みメッセージが存在しなければ作ります
+// 置き換えるフィールドがすでに現れていれば最初に現れた位置に v を書き込み、それ以外の同じフィールドは取り除きます
+// v が Get で取り出した複数の値を持つ場合は、すべての値を順に書き込みます
+//
+// 途中の埋め込みメッセージが複数回現れた場合は、すべての中から同じフィールドを取り除き、最後に現れたメッセージに書き込みます
+// 埋め込みメッセージのバイト長は書き換えに合わせて更新し、それ以外のバイト列はそのまま保持します。 b は変更しません
+func SetField(b []byte, path []int, v Value) ([]byte, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	return editMessage(b, path, &v)
+}
+
+// DeleteField はwireバイナリ b から path のフィールドをすべて取り除いた新しいバイト列を返します
+// 途中の埋め込みメッセージが複数回現れた場合やrepeatedな場合は、そのすべての中から取り除きます
+// 埋め込みメッセージのバイト長は書き換えに合わせて更新し、それ以外のバイト列はそのまま保持します。 b は変更しません
+func DeleteField(b []byte, path []int) ([]byte, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	return editMessage(b, path, nil)
+}
+
+// AppendField はwireバイナリ b の末尾に field numberが num のフィールドとして v を追加した新しいバイト列を返します
+// repeatedなフィールドに要素を追加したり、repeatedでないフィールドを後の値で上書きしたりする場合に利用します。 b は変更しません
+func AppendField(b []byte, num int, v Value) ([]byte, error) {
+	if err := validatePath([]int{num}); err != nil {
+		return nil, err
+	}
+	return appendValue(append([]byte{}, b...), FieldNumber(num), v), nil
+}
+
+func validatePath(path []int) error {
+	if len(path) == 0 {
+		return errors.New("path must not be empty")
+	}
+	for _, num := range path {
+		if num < 0 || !FieldNumber(num).IsValid() {
+			return fmt.Errorf("invalid field number: %d", num)
+		}
+	}
+	return nil
+}
+
+// editMessage はメッセージのバイト列 b の path のフィールドを取り除き、 set がnilでなければ set を書き込んだ新しいバイト列を返します
+func editMessage(b []byte, path []int, set *Value) ([]byte, error) {
+	num := FieldNumber(path[0])
+	// 途中の埋め込みメッセージは最後に現れたものに書き込むので、先に位置を調べておきます
+	lastIndex := -1
+	if len(path) > 1 {
+		for i, rest := 0, b; len(rest) > 0; i++ {
+			fn, wt, n, err := ConsumeTag(rest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tag: %w", err)
+			}
+			m, err := ConsumeFieldValue(wt, rest[n:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read field %d value: %w", fn, err)
+			}
+			if fn == num {
+				lastIndex = i
+			}
+			rest = rest[n+m:]
+		}
+	}
+
+	out := make([]byte, 0, len(b))
+	written := false
+	for i := 0; len(b) > 0; i++ {
+		fn, wt, n, err := ConsumeTag(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tag: %w", err)
+		}
+		tag := b[:n]
+		m, err := ConsumeFieldValue(wt, b[n:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read field %d value: %w", fn, err)
+		}
+		field := b[:n+m]
+		b = b[n+m:]
+
+		if fn != num {
+			out = append(out, field...)
+			continue
+		}
+		if len(path) == 1 {
+			// 置き換えるフィールドは最初に現れた位置に書き込み、それ以外は取り除きます
+			if set != nil && !written {
+				out = appendValue(out, num, *set)
+				written = true
+			}
+			continue
+		}
+		if wt != WireLengthDelimited {
+			return nil, fmt.Errorf("field %d is not an embedded message, wire type: %d", fn, wt)
+		}
+		_, l, _ := ConsumeVarint(field[n:])
+		childSet := set
+		if i != lastIndex {
+			childSet = nil
+		}
+		child, err := editMessage(field[n+l:], path[1:], childSet)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tag...)
+		out = AppendVarint(out, uint64(len(child)))
+		out = append(out, child...)
+	}
+
+	if set != nil && len(path) == 1 && !written {
+		out = appendValue(out, num, *set)
+	}
+	// 途中の埋め込みメッセージが存在しなければ、空のメッセージに書き込んで追加します
+	if set != nil && len(path) > 1 && lastIndex < 0 {
+		child, err := editMessage(nil, path[1:], set)
+		if err != nil {
+			return nil, err
+		}
+		out = AppendTag(out, num, WireLengthDelimited)
+		out = AppendVarint(out, uint64(len(child)))
+		out = append(out, child...)
+	}
+	return out, nil
+}
+
+// appendValue は b に field numberが num のフィールドとして v のすべての値を追加します
+func appendValue(b []byte, num FieldNumber, v Value) []byte {
+	for _, o := range v.occurrences {
+		b = AppendTag(b, num, o.wt)
+		if o.wt == WireLengthDelimited {
+			b = AppendVarint(b, uint64(len(o.raw)))
+		}
+		b = append(b, o.raw...)
+	}
+	return b
+}
@@ -0,0 +1,194 @@
+package protowire
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestSetField(t *testing.T) {
+	embed := &testdata.TestEmbed{
+		EmbedVarint:          &testdata.TestVarint{Int32: 12345, Int64: 67890},
+		EmbedLengthDelimited: &testdata.TestLengthDelimited{Str: "これはてすとだよ", Bytes: []byte{0xFF}},
+	}
+
+	tests := []struct {
+		name string
+		msg  proto.Message
+		path []int
+		v    Value
+		want proto.Message
+	}{
+		{
+			name: "埋め込みメッセージのフィールドを置き換えられる",
+			msg:  embed,
+			path: []int{1, 1},
+			v:    VarintValue(math.MaxUint64), // int32の-1は64bitに符号拡張してエンコードされる
+			want: &testdata.TestEmbed{
+				EmbedVarint:          &testdata.TestVarint{Int32: -1, Int64: 67890},
+				EmbedLengthDelimited: embed.EmbedLengthDelimited,
+			},
+		},
+		{
+			name: "存在しないフィールドは追加される",
+			msg:  embed,
+			path: []int{1, 3},
+			v:    VarintValue(1),
+			want: &testdata.TestEmbed{
+				EmbedVarint:          &testdata.TestVarint{Int32: 12345, Int64: 67890, Boolean: true},
+				EmbedLengthDelimited: embed.EmbedLengthDelimited,
+			},
+		},
+		{
+			name: "存在しない埋め込みメッセージは作られる",
+			msg:  embed,
+			path: []int{3, 3},
+			v:    Fixed64Value(math.Float64bits(1.5)),
+			want: &testdata.TestEmbed{
+				EmbedVarint:          embed.EmbedVarint,
+				EmbedLengthDelimited: embed.EmbedLengthDelimited,
+				Embed64Bit:           &testdata.Test64Bit{Double: 1.5},
+			},
+		},
+		{
+			name: "stringを置き換えられる",
+			msg:  embed,
+			path: []int{2, 1},
+			v:    StringValue("trace-id"),
+			want: &testdata.TestEmbed{
+				EmbedVarint:          embed.EmbedVarint,
+				EmbedLengthDelimited: &testdata.TestLengthDelimited{Str: "trace-id", Bytes: []byte{0xFF}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := proto.Marshal(tt.msg)
+			orig := append([]byte{}, b...)
+			got, err := SetField(b, tt.path, tt.v)
+			if err != nil {
+				t.Fatalf("SetField() error = %v", err)
+			}
+			if !bytes.Equal(b, orig) {
+				t.Errorf("SetField() modified input bytes")
+			}
+			want, _ := proto.Marshal(tt.want)
+			if !bytes.Equal(got, want) {
+				t.Errorf("SetField() got = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestSetField_duplicated(t *testing.T) {
+	// 同じ埋め込みメッセージが複数回現れる場合は、すべての中から取り除いて最後のメッセージに書き込む
+	child := func(fields ...[]byte) []byte {
+		return wire.AppendBytes(wire.AppendTag(nil, 1, wire.BytesType), bytes.Join(fields, nil))
+	}
+	int32Field := func(v uint64) []byte {
+		return wire.AppendVarint(wire.AppendTag(nil, 1, wire.VarintType), v)
+	}
+	int64Field := wire.AppendVarint(wire.AppendTag(nil, 2, wire.VarintType), 2)
+	b := append(child(int32Field(1), int64Field), child(int32Field(1))...)
+
+	got, err := SetField(b, []int{1, 1}, VarintValue(3))
+	if err != nil {
+		t.Fatalf("SetField() error = %v", err)
+	}
+	want := append(child(int64Field), child(int32Field(3))...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("SetField() got = %x, want %x", got, want)
+	}
+}
+
+func TestDeleteField(t *testing.T) {
+	repeated := &testdata.TestRepeated{
+		Int64: []int64{1, 2},
+		Str:   []string{"a", "b"},
+		TestLengthDelimited: []*testdata.TestLengthDelimited{
+			{Str: "pii", Bytes: []byte{0x01}},
+			{Str: "pii"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		msg  proto.Message
+		path []int
+		want proto.Message
+	}{
+		{
+			name: "repeatedなフィールドはすべて取り除かれる",
+			msg:  repeated,
+			path: []int{4},
+			want: &testdata.TestRepeated{
+				Int64:               repeated.Int64,
+				TestLengthDelimited: repeated.TestLengthDelimited,
+			},
+		},
+		{
+			name: "repeatedな埋め込みメッセージのすべての中から取り除かれる",
+			msg:  repeated,
+			path: []int{6, 1},
+			want: &testdata.TestRepeated{
+				Int64: repeated.Int64,
+				Str:   repeated.Str,
+				TestLengthDelimited: []*testdata.TestLengthDelimited{
+					{Bytes: []byte{0x01}},
+					{},
+				},
+			},
+		},
+		{
+			name: "存在しないフィールドを指定しても変わらない",
+			msg:  repeated,
+			path: []int{7, 1},
+			want: repeated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := proto.Marshal(tt.msg)
+			got, err := DeleteField(b, tt.path)
+			if err != nil {
+				t.Fatalf("DeleteField() error = %v", err)
+			}
+			want, _ := proto.Marshal(tt.want)
+			if !bytes.Equal(got, want) {
+				t.Errorf("DeleteField() got = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestAppendField(t *testing.T) {
+	b, _ := proto.Marshal(&testdata.TestRepeated{Str: []string{"a"}})
+	got, err := AppendField(b, 4, StringValue("b"))
+	if err != nil {
+		t.Fatalf("AppendField() error = %v", err)
+	}
+	want, _ := proto.Marshal(&testdata.TestRepeated{Str: []string{"a", "b"}})
+	if !bytes.Equal(got, want) {
+		t.Errorf("AppendField() got = %x, want %x", got, want)
+	}
+}
+
+func TestEdit_error(t *testing.T) {
+	b, _ := proto.Marshal(&testdata.TestVarint{Int32: 12345})
+	if _, err := SetField(b, nil, VarintValue(1)); err == nil {
+		t.Errorf("SetField() error = nil, want empty path error")
+	}
+	if _, err := SetField(b, []int{1, 1}, VarintValue(1)); err == nil {
+		t.Errorf("SetField() error = nil, want not embedded message error")
+	}
+	if _, err := DeleteField(b, []int{0}); err == nil {
+		t.Errorf("DeleteField() error = nil, want invalid field number error")
+	}
+	if _, err := AppendField(b, 1<<29, VarintValue(1)); err == nil {
+		t.Errorf("AppendField() error = nil, want invalid field number error")
+	}
+}
@@ -0,0 +1,324 @@
+package protowire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const protoExtensionsTag = "protowire_extensions"
+
+// ErrMissingExtension は GetExtension で取得しようとした拡張がメッセージに含まれていないことを表します
+var ErrMissingExtension = errors.New("extension not set")
+
+// ExtensionDesc はproto2の拡張フィールドの定義です
+// ExtendedType は拡張されるメッセージのstructのポインタ、 ExtensionType は拡張フィールドの値の型の値です
+// e.g. ExtendedType: (*Base)(nil), ExtensionType: int32(0), Field: 100, Name: "ext_int32", Tag: "100,0,int32,optional"
+type ExtensionDesc struct {
+	ExtendedType  interface{}
+	ExtensionType interface{}
+	Field         int32
+	Name          string
+	Tag           string
+}
+
+// Extensions は拡張フィールドの値を保持します
+// 拡張を受け付けるメッセージは `protowire_extensions` タグに拡張フィールドのfield numberの範囲を指定したフィールドを持ちます
+//
+//	Ext protowire.Extensions `protowire_extensions:"100-199,1000-max"`
+//
+// Unmarshal の時点で登録されている拡張はデコードして保持し、登録されていない拡張はwireバイナリのまま保持します
+type Extensions struct {
+	fields map[FieldNumber]*extensionField
+}
+
+// extensionField はある拡張フィールドの値です
+// value はデコード済みの値へのポインタで、デコードされていない場合は raw にtagを含むwireバイナリを保持します
+// opts は raw を読み取った Unmarshal の設定で、 GetExtension で raw をデコードするときに同じ設定を使います
+// GetExtension は値を読み取るだけの関数として複数のgoroutineから呼び出されうるので、 raw のデコードは mu で排他します
+type extensionField struct {
+	mu    sync.Mutex
+	value reflect.Value
+	raw   []byte
+	opts  UnmarshalOptions
+}
+
+// extensionRange は拡張フィールドとして利用できるfield numberの範囲で、 end も範囲に含みます
+type extensionRange struct {
+	start, end FieldNumber
+}
+
+// extensionsMetadata はメッセージの拡張フィールドを保持するフィールドの情報です
+// embed は拡張フィールドを保持するフィールドがnilのポインタで埋め込まれたstructのフィールドの場合に、値をSetする前に割り当てる先です
+type extensionsMetadata struct {
+	rv     reflect.Value
+	ranges []extensionRange
+	embed  *embeddedPointer
+}
+
+func (em *extensionsMetadata) inRange(fn FieldNumber) bool {
+	for _, r := range em.ranges {
+		if r.start <= fn && fn <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// newExtensionsMetadata は `protowire_extensions` タグの付与されたフィールドから拡張フィールドの情報を読み取ります
+func newExtensionsMetadata(f reflect.StructField, rv reflect.Value) (*extensionsMetadata, error) {
+	if f.Type != reflect.TypeOf(Extensions{}) {
+		return nil, fmt.Errorf("extensions field type must be protowire.Extensions, but %s", f.Type.String())
+	}
+	ranges, err := parseExtensionRanges(f.Tag.Get(protoExtensionsTag))
+	if err != nil {
+		return nil, fmt.Errorf("invalid extension ranges: %w", err)
+	}
+	return &extensionsMetadata{rv: rv, ranges: ranges}, nil
+}
+
+// parseExtensionRanges は `100-199,1000-max` のような形式の拡張フィールドの範囲を読み取ります
+func parseExtensionRanges(s string) ([]extensionRange, error) {
+	var ranges []extensionRange
+	for _, v := range strings.Split(s, ",") {
+		se := strings.SplitN(v, "-", 2)
+		start, err := strconv.ParseUint(se[0], 10, 29)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(se) == 2 {
+			if se[1] == "max" {
+				end = uint64(MaxValidNumber)
+			} else if end, err = strconv.ParseUint(se[1], 10, 29); err != nil {
+				return nil, err
+			}
+		}
+		if start == 0 || start > end {
+			return nil, fmt.Errorf("invalid range: %s", v)
+		}
+		ranges = append(ranges, extensionRange{start: FieldNumber(start), end: FieldNumber(end)})
+	}
+	return ranges, nil
+}
+
+// extensionRegistry は拡張されるメッセージの型ごとに、登録された拡張フィールドを保持します
+var extensionRegistry = struct {
+	sync.RWMutex
+	m map[reflect.Type]map[FieldNumber]*ExtensionDesc
+}{
+	m: make(map[reflect.Type]map[FieldNumber]*ExtensionDesc),
+}
+
+// RegisterExtension は拡張フィールドを登録します
+// 登録した拡張は以降の Unmarshal でデコードされ、 GetExtension で取得できるようになります
+func RegisterExtension(d *ExtensionDesc) error {
+	rt := reflect.TypeOf(d.ExtendedType)
+	if rt == nil || rt.Kind() != reflect.Ptr || rt.Elem().Kind() != reflect.Struct {
+		return errors.New("extended type must be a pointer to struct")
+	}
+	em, err := findExtensionsMetadata(rt.Elem())
+	if err != nil {
+		return err
+	}
+	fn, _, err := d.fieldMetadata(reflect.Value{})
+	if err != nil {
+		return err
+	}
+	if !em.inRange(fn) {
+		return fmt.Errorf("field number %d is not in extension ranges of %s", fn, rt.String())
+	}
+
+	extensionRegistry.Lock()
+	defer extensionRegistry.Unlock()
+	exts, ok := extensionRegistry.m[rt.Elem()]
+	if !ok {
+		exts = make(map[FieldNumber]*ExtensionDesc)
+		extensionRegistry.m[rt.Elem()] = exts
+	}
+	if _, ok := exts[fn]; ok {
+		return fmt.Errorf("extension %d of %s is already registered", fn, rt.String())
+	}
+	exts[fn] = d
+	return nil
+}
+
+// lookupExtension は登録された拡張フィールドを探します
+func lookupExtension(rt reflect.Type, fn FieldNumber) (*ExtensionDesc, bool) {
+	extensionRegistry.RLock()
+	defer extensionRegistry.RUnlock()
+	d, ok := extensionRegistry.m[rt][fn]
+	return d, ok
+}
+
+// fieldMetadata は Tag を読み取って、 rv にbindするための protoFieldMetadata を生成します
+func (d *ExtensionDesc) fieldMetadata(rv reflect.Value) (FieldNumber, protoFieldMetadata, error) {
+	rt := reflect.TypeOf(d.ExtensionType)
+	if rt == nil {
+		return 0, protoFieldMetadata{}, errors.New("extension type must not be nil")
+	}
+	f := reflect.StructField{
+		Name: d.Name,
+		Type: rt,
+		Tag:  reflect.StructTag(fmt.Sprintf(`%s:"%s"`, protoTag, d.Tag)),
+	}
+	fn, fm, err := newProtoFieldMetadata(f, rv)
+	if err != nil {
+		return 0, protoFieldMetadata{}, fmt.Errorf("invalid extension tag: %w", err)
+	}
+	if fn != FieldNumber(d.Field) {
+		return 0, protoFieldMetadata{}, fmt.Errorf("field number of extension tag is %d, but field is %d", fn, d.Field)
+	}
+	if !fm.pt.matchGoType(rt) && !(fm.fts.Has(fieldRepeated) && rt.Kind() == reflect.Slice && fm.pt.matchGoType(rt.Elem())) {
+		return 0, protoFieldMetadata{}, fmt.Errorf("proto type %s can not be bound to %s", fm.pt, rt.String())
+	}
+	return fn, fm, nil
+}
+
+// findExtensionsMetadata はstructから `protowire_extensions` タグの付与されたフィールドを探します
+// Unmarshal と同じく匿名フィールドとして埋め込まれたstructの中も探すように、 newProtoMetadata でstructを読み取ります
+func findExtensionsMetadata(rt reflect.Type) (*extensionsMetadata, error) {
+	pm, err := newProtoMetadata(reflect.New(rt).Interface())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse protoMetadata from %s: %w", rt.String(), err)
+	}
+	if pm.extensions == nil {
+		return nil, fmt.Errorf("%s does not have extensions field", rt.String())
+	}
+	return pm.extensions, nil
+}
+
+// bindExtension は拡張フィールドのバイト列を読み取ります
+// 登録されている拡張であればデコードし、登録されていなければtagを含むwireバイナリをそのまま保持します
+func (d *decodeState) bindExtension(em *extensionsMetadata, msgType reflect.Type, fn FieldNumber, wt WireType, tag, b []byte) (n int, err error) {
+	if err := em.embed.alloc(); err != nil {
+		return 0, err
+	}
+	exts := em.rv.Addr().Interface().(*Extensions)
+	if exts.fields == nil {
+		exts.fields = make(map[FieldNumber]*extensionField)
+	}
+	ef, ok := exts.fields[fn]
+	if !ok {
+		ef = &extensionField{}
+		exts.fields[fn] = ef
+	}
+
+	desc, ok := lookupExtension(msgType, fn)
+	if !ok {
+		n, err := ConsumeFieldValue(wt, b)
+		if err != nil {
+			return 0, fmt.Errorf("failed to skip extension field value: %w", err)
+		}
+		ef.raw = append(append(ef.raw, tag...), b[:n]...)
+		ef.opts = extensionOptions(d.opts)
+		return n, nil
+	}
+	if !ef.value.IsValid() {
+		ef.value = reflect.New(reflect.TypeOf(desc.ExtensionType))
+	}
+	_, fm, err := desc.fieldMetadata(ef.value.Elem())
+	if err != nil {
+		return 0, err
+	}
+	return d.bindBytes(fm, wt, b)
+}
+
+// extensionOptions は登録されていない拡張を後でデコードするときに使う設定を返します
+// 拡張の値は空の値から読み取り、 Paths は拡張を含むメッセージにだけ適用します
+func extensionOptions(o UnmarshalOptions) UnmarshalOptions {
+	o.Merge = false
+	o.Paths = nil
+	return o
+}
+
+// HasExtension は m に拡張フィールドが含まれているかを返します
+func HasExtension(m interface{}, d *ExtensionDesc) bool {
+	exts, err := extensionsOf(m)
+	if err != nil {
+		return false
+	}
+	_, ok := exts.fields[FieldNumber(d.Field)]
+	return ok
+}
+
+// GetExtension は m から拡張フィールドの値を取得します
+// Unmarshal の後に登録された拡張など、wireバイナリのまま保持されている場合はこの時点で、
+// そのwireバイナリを読み取った Unmarshal と同じ UnmarshalOptions でデコードします
+// 同じメッセージに対して複数のgoroutineから同時に呼び出しても安全です
+func GetExtension(m interface{}, d *ExtensionDesc) (interface{}, error) {
+	exts, err := extensionsOf(m)
+	if err != nil {
+		return nil, err
+	}
+	ef, ok := exts.fields[FieldNumber(d.Field)]
+	if !ok {
+		return nil, ErrMissingExtension
+	}
+	ef.mu.Lock()
+	defer ef.mu.Unlock()
+	if len(ef.raw) > 0 {
+		value, err := ef.decode(d)
+		if err != nil {
+			return nil, err
+		}
+		ef.value = value
+		ef.raw = nil
+	}
+	if ef.value.Type().Elem() != reflect.TypeOf(d.ExtensionType) {
+		return nil, fmt.Errorf("extension type mismatch, got: %s, want: %s", ef.value.Type().Elem().String(), reflect.TypeOf(d.ExtensionType).String())
+	}
+	return ef.value.Elem().Interface(), nil
+}
+
+// decode は raw を d の拡張としてデコードした値を返します
+// デコードに失敗しても ef を書き換えないように、新しく確保した値に value をマージしてから raw を読み取ります
+func (ef *extensionField) decode(d *ExtensionDesc) (reflect.Value, error) {
+	value := reflect.New(reflect.TypeOf(d.ExtensionType))
+	_, fm, err := d.fieldMetadata(value.Elem())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if ef.value.IsValid() {
+		if ef.value.Type() != value.Type() {
+			return reflect.Value{}, fmt.Errorf("extension type mismatch, got: %s, want: %s", ef.value.Type().Elem().String(), value.Type().Elem().String())
+		}
+		if err := mergeValue(fm.pt, value.Elem(), ef.value.Elem(), true); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	dec := newDecodeState(ef.opts)
+	dec.capBase = cap(ef.raw)
+	for b := ef.raw; len(b) > 0; {
+		_, wt, n, err := ConsumeTag(b)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("failed to read tag: %w", err)
+		}
+		b = b[n:]
+		n, err = dec.bindBytes(fm, wt, b)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("failed to read extension %s value: %w", d.Name, err)
+		}
+		b = b[n:]
+	}
+	dec.finish(fm.rv)
+	if err := dec.result(); err != nil {
+		return reflect.Value{}, fmt.Errorf("failed to read extension %s value: %w", d.Name, err)
+	}
+	return value, nil
+}
+
+// extensionsOf は m の拡張フィールドを保持するフィールドを返します
+func extensionsOf(m interface{}) (*Extensions, error) {
+	pm, err := newProtoMetadata(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse protoMetadata from input interface{}: %w", err)
+	}
+	if pm.extensions == nil {
+		return nil, fmt.Errorf("%T does not have extensions field", m)
+	}
+	return pm.extensions.rv.Addr().Interface().(*Extensions), nil
+}
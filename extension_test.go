@@ -0,0 +1,316 @@
+package protowire
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
+type testExtendable struct {
+	Name string     `protowire:"1,2,string,optional"`
+	Ext  Extensions `protowire_extensions:"100-199,1000-max"`
+}
+
+func TestUnmarshal_extension(t *testing.T) {
+	t.Cleanup(func() {
+		extensionRegistry.Lock()
+		delete(extensionRegistry.m, reflect.TypeOf(testExtendable{}))
+		extensionRegistry.Unlock()
+	})
+	extSint32 := &ExtensionDesc{
+		ExtendedType:  (*testExtendable)(nil),
+		ExtensionType: int32(0),
+		Field:         100,
+		Name:          "ext_sint32",
+		Tag:           "100,sint32",
+	}
+	extStrs := &ExtensionDesc{
+		ExtendedType:  (*testExtendable)(nil),
+		ExtensionType: []string(nil),
+		Field:         101,
+		Name:          "ext_strs",
+		Tag:           "101,2,string,repeated",
+	}
+	extEmbed := &ExtensionDesc{
+		ExtendedType:  (*testExtendable)(nil),
+		ExtensionType: (*validMessageChild)(nil),
+		Field:         1000,
+		Name:          "ext_embed",
+		Tag:           "1000",
+	}
+	extLate := &ExtensionDesc{
+		ExtendedType:  (*testExtendable)(nil),
+		ExtensionType: uint64(0),
+		Field:         150,
+		Name:          "ext_late",
+		Tag:           "150,uint64",
+	}
+	for _, d := range []*ExtensionDesc{extSint32, extStrs, extEmbed} {
+		if err := RegisterExtension(d); err != nil {
+			t.Fatalf("RegisterExtension() error = %v", err)
+		}
+	}
+
+	var b []byte
+	b = wire.AppendTag(b, 1, wire.BytesType)
+	b = wire.AppendString(b, "extendable")
+	b = wire.AppendTag(b, 100, wire.VarintType)
+	b = wire.AppendVarint(b, wire.EncodeZigZag(-12345))
+	b = wire.AppendTag(b, 101, wire.BytesType)
+	b = wire.AppendString(b, "first")
+	b = wire.AppendTag(b, 150, wire.VarintType)
+	b = wire.AppendVarint(b, 67890)
+	b = wire.AppendTag(b, 101, wire.BytesType)
+	b = wire.AppendString(b, "second")
+	b = wire.AppendTag(b, 1000, wire.BytesType)
+	b = wire.AppendBytes(b, wire.AppendString(wire.AppendTag(nil, 1, wire.BytesType), "child"))
+	// 拡張の範囲外の未知のフィールドは読み飛ばされる
+	b = wire.AppendTag(b, 5, wire.Fixed32Type)
+	b = wire.AppendFixed32(b, 1)
+
+	var got testExtendable
+	if err := Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got.Name != "extendable" {
+		t.Errorf("Unmarshal() Name = %s, want extendable", got.Name)
+	}
+
+	tests := []struct {
+		name    string
+		desc    *ExtensionDesc
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name: "登録済みの拡張を取得できる",
+			desc: extSint32,
+			want: int32(-12345),
+		},
+		{
+			name: "repeatedな拡張を取得できる",
+			desc: extStrs,
+			want: []string{"first", "second"},
+		},
+		{
+			name: "埋め込みメッセージの拡張を取得できる",
+			desc: extEmbed,
+			want: &validMessageChild{Name: "child"},
+		},
+		{
+			name: "Unmarshalの後に登録された拡張もwireバイナリからデコードして取得できる",
+			desc: extLate,
+			want: uint64(67890),
+		},
+		{
+			name: "含まれていない拡張はErrMissingExtension",
+			desc: &ExtensionDesc{
+				ExtendedType:  (*testExtendable)(nil),
+				ExtensionType: int32(0),
+				Field:         102,
+				Name:          "ext_missing",
+				Tag:           "102,int32",
+			},
+			wantErr: ErrMissingExtension,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.desc == extLate {
+				if err := RegisterExtension(extLate); err != nil {
+					t.Fatalf("RegisterExtension() error = %v", err)
+				}
+			}
+			if HasExtension(&got, tt.desc) != (tt.wantErr == nil) {
+				t.Errorf("HasExtension() = %v, want %v", !(tt.wantErr == nil), tt.wantErr == nil)
+			}
+			v, err := GetExtension(&got, tt.desc)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetExtension() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("GetExtension() got = %v, want %v", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		desc *ExtensionDesc
+	}{
+		{
+			name: "拡張フィールドを持たないメッセージには登録できない",
+			desc: &ExtensionDesc{
+				ExtendedType:  (*validMessageChild)(nil),
+				ExtensionType: int32(0),
+				Field:         100,
+				Tag:           "100,int32",
+			},
+		},
+		{
+			name: "拡張の範囲外のfield numberは登録できない",
+			desc: &ExtensionDesc{
+				ExtendedType:  (*testExtendable)(nil),
+				ExtensionType: int32(0),
+				Field:         200,
+				Tag:           "200,int32",
+			},
+		},
+		{
+			name: "タグのfield numberとFieldが一致しないと登録できない",
+			desc: &ExtensionDesc{
+				ExtendedType:  (*testExtendable)(nil),
+				ExtensionType: int32(0),
+				Field:         100,
+				Tag:           "101,int32",
+			},
+		},
+		{
+			name: "ExtensionTypeとタグが矛盾していると登録できない",
+			desc: &ExtensionDesc{
+				ExtendedType:  (*testExtendable)(nil),
+				ExtensionType: "",
+				Field:         100,
+				Tag:           "100,int32",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterExtension(tt.desc); err == nil {
+				t.Errorf("RegisterExtension() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestGetExtension_options(t *testing.T) {
+	t.Cleanup(func() {
+		extensionRegistry.Lock()
+		delete(extensionRegistry.m, reflect.TypeOf(testExtendable{}))
+		extensionRegistry.Unlock()
+	})
+	extStr := &ExtensionDesc{
+		ExtendedType:  (*testExtendable)(nil),
+		ExtensionType: "",
+		Field:         110,
+		Name:          "ext_str",
+		Tag:           "110,string",
+	}
+	b := wire.AppendTag(nil, 110, wire.BytesType)
+	b = wire.AppendBytes(b, []byte{0xFF})
+
+	// 拡張を登録する前にそれぞれの設定でUnmarshalしておく
+	var strict, allowInvalid testExtendable
+	if err := Unmarshal(b, &strict); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := (UnmarshalOptions{AllowInvalidUTF8: true}).Unmarshal(b, &allowInvalid); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := RegisterExtension(extStr); err != nil {
+		t.Fatalf("RegisterExtension() error = %v", err)
+	}
+
+	// 後からデコードする場合もUnmarshalした時点の設定が使われる
+	var uerr *InvalidUTF8Error
+	if _, err := GetExtension(&strict, extStr); !errors.As(err, &uerr) {
+		t.Errorf("GetExtension() error = %v, want *InvalidUTF8Error", err)
+	}
+	v, err := GetExtension(&allowInvalid, extStr)
+	if err != nil {
+		t.Fatalf("GetExtension() error = %v", err)
+	}
+	if v != "\xff" {
+		t.Errorf("GetExtension() got = %q, want %q", v, "\xff")
+	}
+}
+
+func TestGetExtension_concurrent(t *testing.T) {
+	t.Cleanup(func() {
+		extensionRegistry.Lock()
+		delete(extensionRegistry.m, reflect.TypeOf(testExtendable{}))
+		extensionRegistry.Unlock()
+	})
+	extStrs := &ExtensionDesc{
+		ExtendedType:  (*testExtendable)(nil),
+		ExtensionType: []string(nil),
+		Field:         111,
+		Name:          "ext_strs",
+		Tag:           "111,2,string,repeated",
+	}
+	var b []byte
+	for _, s := range []string{"a", "b"} {
+		b = wire.AppendTag(b, 111, wire.BytesType)
+		b = wire.AppendString(b, s)
+	}
+	var m testExtendable
+	if err := Unmarshal(b, &m); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := RegisterExtension(extStrs); err != nil {
+		t.Fatalf("RegisterExtension() error = %v", err)
+	}
+
+	// 同時に呼び出してもwireバイナリは1回だけデコードされる
+	var wg sync.WaitGroup
+	results := make([]interface{}, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = GetExtension(&m, extStrs)
+		}(i)
+	}
+	wg.Wait()
+	for _, got := range results {
+		if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("GetExtension() got = %v, want %v", got, want)
+		}
+	}
+}
+
+type TestExtendableHeader struct {
+	Ext Extensions `protowire_extensions:"100-199"`
+}
+
+type testEmbeddedExtendable struct {
+	*TestExtendableHeader
+	Name string `protowire:"1,2,string,optional"`
+}
+
+func TestRegisterExtension_embedded(t *testing.T) {
+	t.Cleanup(func() {
+		extensionRegistry.Lock()
+		delete(extensionRegistry.m, reflect.TypeOf(testEmbeddedExtendable{}))
+		extensionRegistry.Unlock()
+	})
+	// 埋め込みstructの拡張フィールドにもUnmarshalと同じく登録できる
+	ext := &ExtensionDesc{
+		ExtendedType:  (*testEmbeddedExtendable)(nil),
+		ExtensionType: int32(0),
+		Field:         100,
+		Name:          "ext_int32",
+		Tag:           "100,int32",
+	}
+	if err := RegisterExtension(ext); err != nil {
+		t.Fatalf("RegisterExtension() error = %v", err)
+	}
+	b := wire.AppendVarint(wire.AppendTag(nil, 100, wire.VarintType), 1)
+	m := &testEmbeddedExtendable{}
+	if err := Unmarshal(b, m); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	v, err := GetExtension(m, ext)
+	if err != nil {
+		t.Fatalf("GetExtension() error = %v", err)
+	}
+	if v != int32(1) {
+		t.Errorf("GetExtension() got = %v, want 1", v)
+	}
+}
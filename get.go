@@ -0,0 +1,205 @@
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Value は Get でwireバイナリから取り出したフィールドの値です
+// 同じフィールドが複数回現れた場合やrepeatedなフィールドの場合は、現れたすべての値を順に保持します
+// 型ごとのアクセサは最後に現れた値を返すので、repeatedでないフィールドはprotobufの仕様通り後の値が優先されます
+// アクセサはwire typeが一致しない場合や値が存在しない場合、ゼロ値を返します
+// packedなrepeatedのフィールドはスキーマがなければ要素の型がわからないので、1つのlength delimitedな値として現れます
+type Value struct {
+	occurrences []valueOccurrence
+}
+
+// valueOccurrence はフィールドが1回現れたときの値です
+// raw はvarint, 64-bit, 32-bitではエンコードされた値のバイト列で、length delimitedでは先頭のバイト長を除いた中身です
+type valueOccurrence struct {
+	wt  WireType
+	raw []byte
+}
+
+// Get はstructの定義を使わずに、wireバイナリ b から path のfield numberを順にたどってフィールドの値を取り出します
+// path の途中のフィールドは埋め込みメッセージとして読み取り、複数回現れた場合やrepeatedな場合はそのすべての中を探します
+// フィールドが見つからない場合はエラーにならず、 Exists がfalseの Value を返します
+//
+// repeatedな埋め込みメッセージの特定の要素をたどる場合は、 Index と Message を組み合わせます
+//
+//	friends, err := protowire.Get(b, 3)
+//	name, err := protowire.Get(friends.Index(1).Message(), 1) // friends[1].name
+func Get(b []byte, path ...int) (Value, error) {
+	if len(path) == 0 {
+		return Value{}, errors.New("path must not be empty")
+	}
+	msgs := [][]byte{b}
+	for i, num := range path {
+		var found []valueOccurrence
+		for _, msg := range msgs {
+			occurrences, err := findOccurrences(msg, FieldNumber(num))
+			if err != nil {
+				return Value{}, fmt.Errorf("failed to find field %d: %w", num, err)
+			}
+			found = append(found, occurrences...)
+		}
+		if i == len(path)-1 {
+			return Value{occurrences: found}, nil
+		}
+		msgs = nil
+		for _, o := range found {
+			if o.wt != WireLengthDelimited {
+				return Value{}, fmt.Errorf("field %d is not an embedded message, wire type: %d", num, o.wt)
+			}
+			msgs = append(msgs, o.raw)
+		}
+	}
+	return Value{}, nil
+}
+
+// findOccurrences はメッセージのバイト列 b から field numberが num のフィールドの値をすべて探します
+func findOccurrences(b []byte, num FieldNumber) ([]valueOccurrence, error) {
+	var occurrences []valueOccurrence
+	for len(b) > 0 {
+		fn, wt, n, err := ConsumeTag(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tag: %w", err)
+		}
+		b = b[n:]
+		n, err = ConsumeFieldValue(wt, b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read field %d value: %w", fn, err)
+		}
+		if fn == num {
+			raw := b[:n]
+			if wt == WireLengthDelimited {
+				_, m, _ := ConsumeVarint(raw)
+				raw = raw[m:]
+			}
+			occurrences = append(occurrences, valueOccurrence{wt: wt, raw: raw})
+		}
+		b = b[n:]
+	}
+	return occurrences, nil
+}
+
+// Exists はフィールドがバイト列に含まれていたかを返します
+func (v Value) Exists() bool {
+	return len(v.occurrences) > 0
+}
+
+// Len はフィールドが現れた回数を返します
+func (v Value) Len() int {
+	return len(v.occurrences)
+}
+
+// Index は i 番目に現れた値を返します。範囲外の場合は Exists がfalseの Value を返します
+func (v Value) Index(i int) Value {
+	if i < 0 || i >= len(v.occurrences) {
+		return Value{}
+	}
+	return Value{occurrences: v.occurrences[i : i+1]}
+}
+
+// ForEach は現れた値を順に fn に渡します。 fn がfalseを返すとそこで終了します
+func (v Value) ForEach(fn func(i int, v Value) bool) {
+	for i := range v.occurrences {
+		if !fn(i, v.Index(i)) {
+			return
+		}
+	}
+}
+
+func (v Value) last(wt WireType) ([]byte, bool) {
+	if len(v.occurrences) == 0 {
+		return nil, false
+	}
+	o := v.occurrences[len(v.occurrences)-1]
+	return o.raw, o.wt == wt
+}
+
+// Raw は最後に現れた値のバイト列を返します。length delimitedの場合は先頭のバイト長を除いた中身です
+func (v Value) Raw() []byte {
+	if len(v.occurrences) == 0 {
+		return nil
+	}
+	return v.occurrences[len(v.occurrences)-1].raw
+}
+
+func (v Value) varint() uint64 {
+	raw, ok := v.last(WireVarint)
+	if !ok {
+		return 0
+	}
+	val, _, _ := ConsumeVarint(raw)
+	return val
+}
+
+// Int64 はint32, int64, enumのvarintの値を返します
+func (v Value) Int64() int64 {
+	return int64(v.varint())
+}
+
+// Uint64 はuint32, uint64のvarintの値を返します
+func (v Value) Uint64() uint64 {
+	return v.varint()
+}
+
+// Sint64 はzigzag encodingされたsint32, sint64のvarintの値を返します
+func (v Value) Sint64() int64 {
+	return DecodeZigZag(v.varint())
+}
+
+// Bool はboolのvarintの値を返します
+func (v Value) Bool() bool {
+	return v.varint() != 0
+}
+
+// Fixed32 はfixed32の値を返します。sfixed32は int32(v.Fixed32()) で取り出せます
+func (v Value) Fixed32() uint32 {
+	raw, ok := v.last(WireFixed32)
+	if !ok {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(raw)
+}
+
+// Fixed64 はfixed64の値を返します。sfixed64は int64(v.Fixed64()) で取り出せます
+func (v Value) Fixed64() uint64 {
+	raw, ok := v.last(WireFixed64)
+	if !ok {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(raw)
+}
+
+// Float はfloatの値を返します
+func (v Value) Float() float32 {
+	return math.Float32frombits(v.Fixed32())
+}
+
+// Double はdoubleの値を返します
+func (v Value) Double() float64 {
+	return math.Float64frombits(v.Fixed64())
+}
+
+// String はstringの値を返します
+func (v Value) String() string {
+	return string(v.Bytes())
+}
+
+// Bytes はbytesの値を返します。返すバイト列は b を参照します
+func (v Value) Bytes() []byte {
+	raw, ok := v.last(WireLengthDelimited)
+	if !ok {
+		return nil
+	}
+	return raw
+}
+
+// Message は埋め込みメッセージのバイト列を返します。さらに Get や Unmarshal で読み取れます
+func (v Value) Message() RawMessage {
+	return RawMessage(v.Bytes())
+}
@@ -0,0 +1,195 @@
+package protowire
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestGet(t *testing.T) {
+	embed, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint:          &testdata.TestVarint{Int32: -12345, Int64: 67890, Boolean: true},
+		EmbedLengthDelimited: &testdata.TestLengthDelimited{Str: "これはてすとだよ", Bytes: []byte{0xFF}},
+		Embed64Bit:           &testdata.Test64Bit{Fixed64: 12345, Sfixed64: -67890, Double: 1.23456789},
+	})
+	zigzag, _ := proto.Marshal(&testdata.TestVarintZigzag{Sint32: -12345, Sint64: -67890})
+	fixed32, _ := proto.Marshal(&testdata.Test32Bit{Fixed32: 12345, Sfixed32: -67890, Float: 1.5})
+	repeated, _ := proto.Marshal(&testdata.TestRepeated{
+		Str: []string{"a", "b", "c"},
+		TestLengthDelimited: []*testdata.TestLengthDelimited{
+			{Str: "first"},
+			{Str: "second"},
+		},
+	})
+	// 同じ埋め込みメッセージが複数回現れると、後に現れた値が優先される
+	merged := append(append([]byte{}, embed...), wire.AppendBytes(wire.AppendTag(nil, 1, wire.BytesType), wire.AppendVarint(wire.AppendTag(nil, 1, wire.VarintType), 1))...)
+
+	tests := []struct {
+		name string
+		b    []byte
+		path []int
+		got  func(Value) interface{}
+		want interface{}
+	}{
+		{
+			name: "埋め込みメッセージのint32を取り出せる",
+			b:    embed,
+			path: []int{1, 1},
+			got:  func(v Value) interface{} { return v.Int64() },
+			want: int64(-12345),
+		},
+		{
+			name: "埋め込みメッセージのboolを取り出せる",
+			b:    embed,
+			path: []int{1, 3},
+			got:  func(v Value) interface{} { return v.Bool() },
+			want: true,
+		},
+		{
+			name: "埋め込みメッセージのstringを取り出せる",
+			b:    embed,
+			path: []int{2, 1},
+			got:  func(v Value) interface{} { return v.String() },
+			want: "これはてすとだよ",
+		},
+		{
+			name: "埋め込みメッセージのsfixed64を取り出せる",
+			b:    embed,
+			path: []int{3, 2},
+			got:  func(v Value) interface{} { return int64(v.Fixed64()) },
+			want: int64(-67890),
+		},
+		{
+			name: "doubleを取り出せる",
+			b:    embed,
+			path: []int{3, 3},
+			got:  func(v Value) interface{} { return v.Double() },
+			want: 1.23456789,
+		},
+		{
+			name: "sint64を取り出せる",
+			b:    zigzag,
+			path: []int{2},
+			got:  func(v Value) interface{} { return v.Sint64() },
+			want: int64(-67890),
+		},
+		{
+			name: "sfixed32を取り出せる",
+			b:    fixed32,
+			path: []int{2},
+			got:  func(v Value) interface{} { return int32(v.Fixed32()) },
+			want: int32(-67890),
+		},
+		{
+			name: "floatを取り出せる",
+			b:    fixed32,
+			path: []int{3},
+			got:  func(v Value) interface{} { return v.Float() },
+			want: float32(1.5),
+		},
+		{
+			name: "埋め込みメッセージのバイト列を取り出せる",
+			b:    embed,
+			path: []int{2},
+			got: func(v Value) interface{} {
+				b, _ := Get(v.Message(), 2)
+				return b.Bytes()
+			},
+			want: []byte{0xFF},
+		},
+		{
+			name: "複数回現れた埋め込みメッセージは後の値を優先する",
+			b:    merged,
+			path: []int{1, 1},
+			got:  func(v Value) interface{} { return []interface{}{v.Len(), v.Int64()} },
+			want: []interface{}{2, int64(1)},
+		},
+		{
+			name: "repeatedのすべての値を順に取り出せる",
+			b:    repeated,
+			path: []int{4},
+			got: func(v Value) interface{} {
+				var s []string
+				v.ForEach(func(i int, v Value) bool {
+					s = append(s, v.String())
+					return true
+				})
+				return s
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "repeatedの要素をindexで取り出せる",
+			b:    repeated,
+			path: []int{4},
+			got:  func(v Value) interface{} { return v.Index(1).String() },
+			want: "b",
+		},
+		{
+			name: "repeatedな埋め込みメッセージの中のフィールドをすべて取り出せる",
+			b:    repeated,
+			path: []int{6, 1},
+			got:  func(v Value) interface{} { return []string{v.Index(0).String(), v.Index(1).String()} },
+			want: []string{"first", "second"},
+		},
+		{
+			name: "存在しないフィールドはExistsがfalse",
+			b:    embed,
+			path: []int{1, 100},
+			got:  func(v Value) interface{} { return []interface{}{v.Exists(), v.Int64(), v.Index(0).Exists()} },
+			want: []interface{}{false, int64(0), false},
+		},
+		{
+			name: "wire typeが一致しないアクセサはゼロ値",
+			b:    embed,
+			path: []int{2, 1},
+			got:  func(v Value) interface{} { return v.Fixed64() },
+			want: uint64(0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Get(tt.b, tt.path...)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got := tt.got(v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGet_error(t *testing.T) {
+	b, _ := proto.Marshal(&testdata.TestVarint{Int32: 12345})
+	tests := []struct {
+		name string
+		b    []byte
+		path []int
+	}{
+		{
+			name: "pathが空だとエラー",
+			b:    b,
+		},
+		{
+			name: "埋め込みメッセージでないフィールドをたどるとエラー",
+			b:    b,
+			path: []int{1, 1},
+		},
+		{
+			name: "バイト列が途中で終わっているとエラー",
+			b:    b[:len(b)-1],
+			path: []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Get(tt.b, tt.path...); err == nil {
+				t.Errorf("Get() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package protowire
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// grpcHeaderSize はgRPCのLength-Prefixed-Messageのヘッダのバイト数です
+// 1バイトの圧縮フラグと、4バイトのbig endianのメッセージ長からなります
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#requests
+const grpcHeaderSize = 5
+
+// Decompressor は圧縮フラグが立ったgRPCのフレームを展開します
+type Decompressor interface {
+	Decompress(r io.Reader) (io.Reader, error)
+}
+
+// GzipDecompressor は標準ライブラリの compress/gzip でgzipのフレームを展開する Decompressor です
+type GzipDecompressor struct{}
+
+func (GzipDecompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// GRPCReader はgRPCのHTTP/2 DATAフレームのペイロードを保存したものなどから、
+// Length-Prefixed-Messageの形式でフレーム化されたメッセージを1つずつ読み取ります
+type GRPCReader struct {
+	// Options は読み取りの設定で、 UnmarshalOptions.Unmarshal と同じように扱います
+	Options UnmarshalOptions
+	// MaxSize は1つのメッセージとして読み取れる最大のバイト数で、圧縮されたフレームでは展開後のバイト数にも適用します
+	// 0の場合は DefaultMaxValueSize です。これを超えるメッセージが現れると ErrValueTooLarge を返します
+	MaxSize int
+	// Decompressor は圧縮フラグが立ったフレームの展開に利用します。nilの場合は GzipDecompressor です
+	Decompressor Decompressor
+
+	r io.Reader
+}
+
+// NewGRPCReader は r から読み取る GRPCReader を返します
+func NewGRPCReader(r io.Reader) *GRPCReader {
+	return &GRPCReader{r: r}
+}
+
+// Next は次のフレームを読み取って v にbindします
+// フレームの境界で r が終端に達した場合は io.EOF を返し、フレームの途中で終端に達した場合は io.ErrUnexpectedEOF を返します
+func (gr *GRPCReader) Next(v interface{}) error {
+	var header [grpcHeaderSize]byte
+	if _, err := io.ReadFull(gr.r, header[:]); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return fmt.Errorf("failed to read frame header: %w", err)
+	}
+	compressed := header[0]
+	if compressed > 1 {
+		return fmt.Errorf("invalid compressed flag: %d", compressed)
+	}
+	byteLen := binary.BigEndian.Uint32(header[1:])
+	max := gr.MaxSize
+	if max <= 0 {
+		max = DefaultMaxValueSize
+	}
+	if uint64(byteLen) > uint64(max) {
+		return fmt.Errorf("%w: %d bytes", ErrValueTooLarge, byteLen)
+	}
+	msg := make([]byte, byteLen)
+	if _, err := io.ReadFull(gr.r, msg); err != nil {
+		return fmt.Errorf("failed to read frame: %w", unexpectedEOF(err))
+	}
+
+	if compressed == 1 {
+		var err error
+		if msg, err = gr.decompress(msg, max); err != nil {
+			return fmt.Errorf("failed to decompress frame: %w", err)
+		}
+	}
+	return gr.Options.Unmarshal(msg, v)
+}
+
+// decompress はフレームを展開します。展開後のバイト数が max を超える場合は ErrValueTooLarge を返します
+func (gr *GRPCReader) decompress(msg []byte, max int) ([]byte, error) {
+	dc := gr.Decompressor
+	if dc == nil {
+		dc = GzipDecompressor{}
+	}
+	r, err := dc.Decompress(bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	// 展開後のサイズを制限するため、 max を1バイト超えるまで読み取ります
+	b, err := io.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > max {
+		return nil, fmt.Errorf("%w: decompressed message exceeds %d bytes", ErrValueTooLarge, max)
+	}
+	return b, nil
+}
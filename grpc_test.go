@@ -0,0 +1,129 @@
+package protowire
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+)
+
+// grpcFrame はgRPCのLength-Prefixed-Messageの形式でフレーム化します
+func grpcFrame(compressed byte, msg []byte) []byte {
+	b := []byte{compressed, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// reverseDecompressor はバイト列を逆順にするだけのテスト用の Decompressor
+type reverseDecompressor struct{}
+
+func (reverseDecompressor) Decompress(r io.Reader) (io.Reader, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return bytes.NewReader(b), nil
+}
+
+func TestGRPCReader_Next(t *testing.T) {
+	first, _ := proto.Marshal(&testdata.TestVarint{Int32: 12345})
+	second, _ := proto.Marshal(&testdata.TestVarint{Int64: 67890, Boolean: true})
+	reversed := append([]byte{}, second...)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	stream := append(grpcFrame(0, first), grpcFrame(1, gzipped(second))...)
+
+	tests := []struct {
+		name         string
+		b            []byte
+		maxSize      int
+		decompressor Decompressor
+		want         []*testDelimited
+		wantErr      error
+	}{
+		{
+			name:    "非圧縮とgzipのフレームを読み取った後はio.EOFを返す",
+			b:       stream,
+			want:    []*testDelimited{{Int32: 12345}, {Int64: 67890, Boolean: true}},
+			wantErr: io.EOF,
+		},
+		{
+			name:         "Decompressorを差し替えられる",
+			b:            grpcFrame(1, reversed),
+			decompressor: reverseDecompressor{},
+			want:         []*testDelimited{{Int64: 67890, Boolean: true}},
+			wantErr:      io.EOF,
+		},
+		{
+			name:    "ヘッダの途中で終端に達するとio.ErrUnexpectedEOFを返す",
+			b:       append(grpcFrame(0, first), 0, 0),
+			want:    []*testDelimited{{Int32: 12345}},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "メッセージの途中で終端に達するとio.ErrUnexpectedEOFを返す",
+			b:       stream[:len(stream)-1],
+			want:    []*testDelimited{{Int32: 12345}},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "MaxSizeを超えるフレームはエラー",
+			b:       grpcFrame(0, first),
+			maxSize: 2,
+			wantErr: ErrValueTooLarge,
+		},
+		{
+			name:    "展開後にMaxSizeを超えるフレームはエラー",
+			b:       grpcFrame(1, gzipped(make([]byte, 1000))),
+			maxSize: 100,
+			wantErr: ErrValueTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gr := NewGRPCReader(bytes.NewReader(tt.b))
+			gr.MaxSize = tt.maxSize
+			gr.Decompressor = tt.decompressor
+			var got []*testDelimited
+			var err error
+			for {
+				v := &testDelimited{}
+				if err = gr.Next(v); err != nil {
+					break
+				}
+				got = append(got, v)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Next() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Next() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPCReader_Next_invalidFlag(t *testing.T) {
+	gr := NewGRPCReader(bytes.NewReader(grpcFrame(2, nil)))
+	if err := gr.Next(&testDelimited{}); err == nil {
+		t.Errorf("Next() error = nil, want invalid compressed flag error")
+	}
+}
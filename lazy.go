@@ -0,0 +1,79 @@
+package protowire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Lazy は埋め込みメッセージを Unmarshal の時点では読み取らずにバイト列のまま保持し、最初にアクセスしたときに読み取ります
+// 大きな埋め込みメッセージを持つメッセージのうち、一部のフィールドしか参照しない場合に読み取りのコストを省けます
+// `*Lazy` 型のフィールドにproto typeとしてembedを指定して利用します
+//
+//	type Parent struct {
+//		Child *protowire.Lazy `protowire:"2,2,embed,optional"`
+//	}
+type Lazy struct {
+	raw  []byte
+	opts UnmarshalOptions
+
+	once  sync.Once
+	value reflect.Value
+	err   error
+}
+
+var lazyType = reflect.TypeOf((*Lazy)(nil))
+
+// newLazy は prev のバイト列の後ろに raw を連結した新しい Lazy を返します
+// 埋め込みメッセージのバイト列を連結したものはそれぞれのメッセージをマージしたものとして読み取られるので、
+// 同じフィールドが複数回現れた場合や Merge の場合でも、読み取った時点でマージの規則が適用されます
+func newLazy(prev *Lazy, raw []byte, opts UnmarshalOptions) *Lazy {
+	// 埋め込みメッセージ自体は空の値から読み取り、 Paths は Lazy の外側のメッセージにだけ適用します
+	opts.Merge = false
+	opts.Paths = nil
+	if prev == nil && opts.Alias {
+		return &Lazy{raw: raw, opts: opts}
+	}
+	var b []byte
+	if prev != nil {
+		b = append(b, prev.raw...)
+	}
+	return &Lazy{raw: append(b, raw...), opts: opts}
+}
+
+// Raw は埋め込みメッセージのバイト列を返します
+func (l *Lazy) Raw() []byte {
+	if l == nil {
+		return nil
+	}
+	return l.raw
+}
+
+// Decode は埋め込みメッセージを読み取って、structのポインタである v にSetします
+// 読み取りは最初の呼び出しでだけ行い、その結果やエラーは以降の呼び出しでも再利用します。複数のgoroutineから同時に呼び出しても安全です
+// v には常に同じ型を渡す必要があります。読み取った値はシャローコピーでSetするので、sliceや埋め込みメッセージは呼び出し間で共有されます
+//
+// 埋め込みメッセージのrequiredなフィールドの検証や UnmarshalOptions.Strict の検証は、 Unmarshal ではなくこの呼び出しで行います
+// l が nil の場合は空のメッセージとして読み取ります
+func (l *Lazy) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("target value must be a non-nil pointer")
+	}
+	if l == nil {
+		return Unmarshal(nil, v)
+	}
+	l.once.Do(func() {
+		l.value = reflect.New(rv.Type().Elem())
+		l.err = l.opts.Unmarshal(l.raw, l.value.Interface())
+	})
+	if l.err != nil {
+		return fmt.Errorf("failed to decode lazy message: %w", l.err)
+	}
+	if l.value.Type() != rv.Type() {
+		return fmt.Errorf("lazy message was decoded as %s, but target is %s", l.value.Type().String(), rv.Type().String())
+	}
+	rv.Elem().Set(l.value.Elem())
+	return nil
+}
@@ -0,0 +1,150 @@
+package protowire
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
+type testLazyChild struct {
+	Int32   int32 `protowire:"1,0,int32,optional"`
+	Int64   int64 `protowire:"2,0,int64,optional"`
+	Boolean bool  `protowire:"3,0,bool,optional"`
+}
+
+type testLazy struct {
+	EmbedVarint *Lazy `protowire:"1,2,embed,optional"`
+}
+
+func TestLazy_Decode(t *testing.T) {
+	first, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{Int32: 12345, Int64: 67890},
+	})
+	second, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{Int32: -12345, Boolean: true},
+	})
+	// 埋め込みメッセージのフィールドの途中でバイト列が終わっている
+	broken := wire.AppendBytes(wire.AppendTag(nil, 1, wire.BytesType), []byte{0x08, 0x80})
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    *testLazyChild
+		wantErr bool
+	}{
+		{
+			name: "アクセスしたときに埋め込みメッセージを読み取る",
+			b:    first,
+			want: &testLazyChild{Int32: 12345, Int64: 67890},
+		},
+		{
+			name: "複数回現れた埋め込みメッセージはマージして読み取る",
+			b:    append(append([]byte{}, first...), second...),
+			want: &testLazyChild{Int32: -12345, Int64: 67890, Boolean: true},
+		},
+		{
+			name: "バイト列に含まれていなければ空のメッセージとして読み取る",
+			b:    nil,
+			want: &testLazyChild{},
+		},
+		{
+			name:    "埋め込みメッセージのエラーはアクセスしたときに報告する",
+			b:       broken,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &testLazy{}
+			if err := Unmarshal(tt.b, v); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			for i := 0; i < 2; i++ {
+				got := &testLazyChild{}
+				err := v.EmbedVarint.Decode(got)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					continue
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Decode() got = %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLazy_Decode_concurrent(t *testing.T) {
+	b, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{Int32: 12345},
+	})
+	v := &testLazy{}
+	if err := Unmarshal(b, v); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got := &testLazyChild{}
+			if err := v.EmbedVarint.Decode(got); err != nil {
+				errs <- err
+				return
+			}
+			if got.Int32 != 12345 {
+				errs <- errors.New("unexpected value")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Decode() error = %v", err)
+	}
+
+	// 最初に読み取った型と異なる型ではエラー
+	if err := v.EmbedVarint.Decode(&testDelimited{}); err == nil {
+		t.Errorf("Decode() error = nil, want type mismatch error")
+	}
+}
+
+func TestLazy_merge(t *testing.T) {
+	first, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{Int32: 12345},
+	})
+	second, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{Int64: 67890},
+	})
+	dst, src := &testLazy{}, &testLazy{}
+	if err := Unmarshal(first, dst); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := Unmarshal(second, src); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	// 読み取り済みの Lazy にマージしても、マージ後の値を読み取れる
+	if err := dst.EmbedVarint.Decode(&testLazyChild{}); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if err := Merge(dst, src); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	got := &testLazyChild{}
+	if err := dst.EmbedVarint.Decode(got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := &testLazyChild{Int32: 12345, Int64: 67890}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() got = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+package protowire
+
+import "strings"
+
+// fieldMask は UnmarshalOptions.Paths をフィールド名ごとの木にしたものです
+// 値がnilのフィールドはパスの末端で、そのフィールド全体を読み取ります
+type fieldMask map[string]fieldMask
+
+// newFieldMask は paths から fieldMask を作ります。 paths が空の場合はnilを返します
+// `user` と `user.address` のように一方がもう一方を含む場合は、短いパスを優先してフィールド全体を読み取ります
+func newFieldMask(paths []string) fieldMask {
+	if len(paths) == 0 {
+		return nil
+	}
+	root := fieldMask{}
+	for _, p := range paths {
+		names := strings.Split(p, ".")
+		node := root
+		for i, name := range names {
+			child, ok := node[name]
+			if ok && child == nil {
+				break
+			}
+			if i == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			if !ok {
+				child = fieldMask{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// maskOut は Paths が指定されていて、 fn のフィールドがいま読み取っているメッセージのパスに含まれていないかを返します
+// 拡張フィールドなど、名前を持たないフィールドは含まれていないものとして扱います
+func (d *decodeState) maskOut(pm protoMetadata, fn FieldNumber) bool {
+	if d.mask == nil {
+		return false
+	}
+	var name string
+	if fm, ok := pm.fields[fn]; ok {
+		name = fm.name
+	} else if ofm, ok := pm.oneOfFields[fn]; ok {
+		name = ofm.protoFieldMetadata.name
+	} else {
+		return true
+	}
+	_, ok := d.mask[name]
+	return !ok
+}
+
+// enterMask は name のフィールドを読み取る間、 mask をそのフィールドの中のパスに切り替えます
+// パスの末端のフィールドであればバイト列に含まれていたことを記録し、その中のフィールドはすべて読み取ります
+// 戻り値の関数を呼び出すと元の mask に戻します
+func (d *decodeState) enterMask(name string) (leave func()) {
+	prev := d.mask
+	if prev == nil {
+		return func() {}
+	}
+	child := prev[name]
+	if child == nil {
+		if d.present == nil {
+			d.present = make(map[string]bool)
+		}
+		d.present[d.fieldPath(name)] = true
+	}
+	d.mask = child
+	return func() { d.mask = prev }
+}
+
+// UnmarshalPaths は Unmarshal と同じくwireバイナリを読み取って v にbindし、
+// o.Paths のうちバイト列に含まれていたパスを o.Paths と同じ順序で返します
+func (o UnmarshalOptions) UnmarshalPaths(b []byte, v interface{}) (present []string, err error) {
+	d, err := o.unmarshal(b, v)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range o.Paths {
+		// 短いパスに含まれるパスは、短いパスが含まれていれば含まれていたものとします
+		names := strings.Split(p, ".")
+		for i := range names {
+			if d.present[strings.Join(names[:i+1], ".")] {
+				present = append(present, p)
+				break
+			}
+		}
+	}
+	return present, nil
+}
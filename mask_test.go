@@ -0,0 +1,111 @@
+package protowire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
+type testMaskAddress struct {
+	City string `protowire:"1,name=city"`
+	Zip  string `protowire:"2,name=zip"`
+}
+
+type testMaskUser struct {
+	Name    string           `protowire:"1,name=name"`
+	Address *testMaskAddress `protowire:"2,name=address"`
+}
+
+type testMask struct {
+	ID       int64           `protowire:"1,name=id"`
+	User     *testMaskUser   `protowire:"2,name=user"`
+	Friends  []*testMaskUser `protowire:"3,name=friends"`
+	Required int32           `protowire:"4,0,int32,required,name=req"`
+}
+
+func TestUnmarshalOptions_UnmarshalPaths(t *testing.T) {
+	str := func(b []byte, fn wire.Number, s string) []byte {
+		return wire.AppendString(wire.AppendTag(b, fn, wire.BytesType), s)
+	}
+	embed := func(b []byte, fn wire.Number, child []byte) []byte {
+		return wire.AppendBytes(wire.AppendTag(b, fn, wire.BytesType), child)
+	}
+	address := str(str(nil, 1, "Tokyo"), 2, "100-0001")
+	user := embed(str(nil, 1, "alice"), 2, address)
+	friend := str(nil, 1, "bob")
+	var b []byte
+	b = wire.AppendVarint(wire.AppendTag(b, 1, wire.VarintType), 12345)
+	b = embed(b, 2, user)
+	b = embed(b, 3, friend)
+	b = embed(b, 3, friend)
+
+	tests := []struct {
+		name        string
+		paths       []string
+		want        *testMask
+		wantPresent []string
+	}{
+		{
+			name:  "パスのフィールドだけを読み取り、requiredなフィールドが含まれていなくてもエラーにしない",
+			paths: []string{"user.address.city"},
+			want: &testMask{
+				User: &testMaskUser{Address: &testMaskAddress{City: "Tokyo"}},
+			},
+			wantPresent: []string{"user.address.city"},
+		},
+		{
+			name:  "バイト列に含まれていなかったパスは報告しない",
+			paths: []string{"id", "user.name", "user.address.unknown"},
+			want: &testMask{
+				ID:   12345,
+				User: &testMaskUser{Name: "alice", Address: &testMaskAddress{}},
+			},
+			wantPresent: []string{"id", "user.name"},
+		},
+		{
+			name:  "短いパスを優先してフィールド全体を読み取る",
+			paths: []string{"user.address.city", "user"},
+			want: &testMask{
+				User: &testMaskUser{Name: "alice", Address: &testMaskAddress{City: "Tokyo", Zip: "100-0001"}},
+			},
+			wantPresent: []string{"user.address.city", "user"},
+		},
+		{
+			name:  "repeatedな埋め込みメッセージのそれぞれの要素にパスを適用する",
+			paths: []string{"friends.name"},
+			want: &testMask{
+				Friends: []*testMaskUser{{Name: "bob"}, {Name: "bob"}},
+			},
+			wantPresent: []string{"friends.name"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := UnmarshalOptions{Paths: tt.paths}
+			got := &testMask{}
+			present, err := o.UnmarshalPaths(b, got)
+			if err != nil {
+				t.Fatalf("UnmarshalPaths() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalPaths() got = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(present, tt.wantPresent) {
+				t.Errorf("UnmarshalPaths() present = %v, want %v", present, tt.wantPresent)
+			}
+
+			// Decoder でも同じくパスのフィールドだけを読み取る
+			dec := NewDecoder(bytes.NewReader(b))
+			dec.Options = o
+			got = &testMask{}
+			if err := dec.Decode(got); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
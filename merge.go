@@ -0,0 +1,173 @@
+package protowire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Merge は src の値を dst にマージします。 dst と src は同じstructのポインタである必要があります
+// マージの規則はwireバイナリに同じフィールドが複数回現れた場合の Unmarshal と同じで、以下の通りです
+//   - スカラー値: src がゼロ値でなければ src の値で上書きします
+//   - 埋め込みメッセージ: 再帰的にマージします
+//   - repeated: src の要素を dst の後ろに追加します
+//   - oneof: 同じ実装がSetされていればマージし、別の実装であれば src の値で置き換えます
+//
+// dst は src の値を参照しないように、bytesや埋め込みメッセージはコピーされます
+func Merge(dst, src interface{}) error {
+	if reflect.TypeOf(dst) != reflect.TypeOf(src) {
+		return fmt.Errorf("dst and src must be the same type, dst: %T, src: %T", dst, src)
+	}
+	if reflect.TypeOf(dst).Kind() != reflect.Ptr {
+		return errors.New("target value must be a pointer")
+	}
+	if reflect.ValueOf(src).IsNil() {
+		return nil
+	}
+	if reflect.ValueOf(dst).IsNil() {
+		return errors.New("dst must not be nil")
+	}
+	dpm, err := newProtoMetadata(dst)
+	if err != nil {
+		return fmt.Errorf("failed to parse protoMetadata from dst: %w", err)
+	}
+	spm, err := newProtoMetadata(src)
+	if err != nil {
+		return fmt.Errorf("failed to parse protoMetadata from src: %w", err)
+	}
+
+	for fn, dfm := range dpm.fields {
+		sfm := spm.fields[fn]
+		// src でnilのポインタで埋め込まれたstructのフィールドはすべてゼロ値なので、マージするものがありません
+		if sfm.embed.isNil() {
+			continue
+		}
+		if !dfm.rv.CanSet() {
+			return fmt.Errorf("cant't set field %s, field type: %s", dfm.label(), dfm.rv.Type().String())
+		}
+		if err := dfm.embed.alloc(); err != nil {
+			return fmt.Errorf("failed to merge field %s: %w", dfm.label(), err)
+		}
+		if err := mergeValue(dfm.pt, dfm.rv, sfm.rv, false); err != nil {
+			return fmt.Errorf("failed to merge field %s: %w", dfm.label(), err)
+		}
+	}
+	for fn, sofm := range spm.oneOfFields {
+		if !sofm.isSet() {
+			continue
+		}
+		dofm := dpm.oneOfFields[fn]
+		if !dofm.iface.CanSet() {
+			return fmt.Errorf("cant't set oneof field, field type: %s", dofm.iface.Type().String())
+		}
+		if err := dofm.embed.alloc(); err != nil {
+			return fmt.Errorf("failed to merge oneof %s: %w", dofm.name, err)
+		}
+		impl, fm := dofm.bindImplement()
+		if err := mergeValue(fm.pt, fm.rv, sofm.iface.Elem().Elem().Field(0), true); err != nil {
+			return fmt.Errorf("failed to merge oneof %s field %s: %w", dofm.name, fm.label(), err)
+		}
+		dofm.iface.Set(impl)
+	}
+	if spm.extensions != nil && !spm.extensions.embed.isNil() {
+		if err := dpm.extensions.embed.alloc(); err != nil {
+			return fmt.Errorf("failed to merge extensions: %w", err)
+		}
+		dst := dpm.extensions.rv.Addr().Interface().(*Extensions)
+		src := spm.extensions.rv.Addr().Interface().(*Extensions)
+		if err := dst.merge(src); err != nil {
+			return fmt.Errorf("failed to merge extensions: %w", err)
+		}
+	}
+	return nil
+}
+
+// mergeValue は proto type に従って src の値を dst にマージします
+// presence が true の場合はoneofのメンバーのように値の有無を区別するフィールドとして、ゼロ値であっても上書きします
+func mergeValue(pt protoType, dst, src reflect.Value, presence bool) error {
+	switch {
+	case isRepeatedType(src.Type()):
+		// Merge(v, v) のように dst と src が同じフィールドの場合、 dst への追加で src も伸びるので、
+		// 追加する前の src の要素だけを対象にします
+		src = src.Slice(0, src.Len())
+		for i := 0; i < src.Len(); i++ {
+			elem := reflect.New(src.Type().Elem()).Elem()
+			if err := mergeValue(pt, elem, src.Index(i), true); err != nil {
+				return err
+			}
+			dst.Set(reflect.Append(dst, elem))
+		}
+	case pt == protoEmbed && src.Type() == lazyType:
+		if src.IsNil() {
+			return nil
+		}
+		slazy := src.Interface().(*Lazy)
+		dlazy, _ := dst.Interface().(*Lazy)
+		// dst が src のバイト列を参照しないようにコピーします
+		opts := slazy.opts
+		opts.Alias = false
+		dst.Set(reflect.ValueOf(newLazy(dlazy, slazy.raw, opts)))
+	case pt == protoEmbed:
+		if src.IsNil() {
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return Merge(dst.Interface(), src.Interface())
+	case pt == protoRaw && dst.Len() > 0:
+		// rawは埋め込みメッセージなので、 src のバイト列を dst の後ろに連結します
+		n := dst.Len()
+		dst.SetBytes(append(dst.Bytes()[:n:n], src.Bytes()...))
+	case pt == protoBytes || pt == protoRaw:
+		if src.Len() > 0 || presence {
+			dst.SetBytes(append([]byte{}, src.Bytes()...))
+		}
+	default:
+		if !src.IsZero() || presence {
+			dst.Set(src)
+		}
+	}
+	return nil
+}
+
+// merge は src の拡張フィールドを e にマージします
+// wireバイナリのまま保持されている拡張は、 Unmarshal と同じく後ろに連結します
+func (e *Extensions) merge(src *Extensions) error {
+	for fn, sef := range src.fields {
+		if e.fields == nil {
+			e.fields = make(map[FieldNumber]*extensionField)
+		}
+		ef, ok := e.fields[fn]
+		if !ok {
+			ef = &extensionField{}
+			e.fields[fn] = ef
+		}
+		// src の拡張は GetExtension で同時にデコードされうるので、 mu で排他して読み取ります
+		sef.mu.Lock()
+		ef.raw = append(ef.raw, sef.raw...)
+		if len(sef.raw) > 0 {
+			ef.opts = sef.opts
+		}
+		svalue := sef.value
+		sef.mu.Unlock()
+		if !svalue.IsValid() {
+			continue
+		}
+		if !ef.value.IsValid() {
+			ef.value = reflect.New(svalue.Type().Elem())
+		}
+		if ef.value.Type() != svalue.Type() {
+			return fmt.Errorf("extension %d type mismatch, dst: %s, src: %s", fn, ef.value.Type().Elem().String(), svalue.Type().Elem().String())
+		}
+		// 拡張の値の型はGoの型から推論したproto typeでマージしても、埋め込みメッセージとbytesの扱いは変わりません
+		pt, err := inferProtoType(ef.value.Type().Elem())
+		if err != nil {
+			return fmt.Errorf("failed to infer proto type of extension %d: %w", fn, err)
+		}
+		if err := mergeValue(pt, ef.value.Elem(), svalue.Elem(), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
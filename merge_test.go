@@ -0,0 +1,299 @@
+package protowire
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+)
+
+type testMergeChild struct {
+	Int32 int32  `protowire:"1,0,int32,optional"`
+	Str   string `protowire:"2,2,string,optional"`
+}
+
+type testMerge struct {
+	Int32    int32             `protowire:"1,0,int32,optional"`
+	Bytes    []byte            `protowire:"2,2,bytes,optional"`
+	Embed    *testMergeChild   `protowire:"3,2,embed,optional"`
+	Repeated []int64           `protowire:"4,2,int64,packed,repeated"`
+	Children []*testMergeChild `protowire:"5,2,embed,repeated"`
+}
+
+type TestMergeChild struct {
+	Int32 int32 `protowire:"1,0,int32,optional"`
+}
+
+type testEmbeddedStruct struct {
+	*TestMergeChild
+	Str string `protowire:"2,2,string,optional"`
+}
+
+func TestUnmarshal_merge(t *testing.T) {
+	// 2つのメッセージを連結したバイト列は、それぞれのメッセージをマージしたものとして読み取られる
+	first, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{
+			Int32: 12345,
+			Int64: 67890,
+		},
+	})
+	second, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint: &testdata.TestVarint{
+			Int32:   -12345,
+			Boolean: true,
+		},
+	})
+	type testVarint struct {
+		Int32   int32 `protowire:"1,0,int32,optional"`
+		Int64   int64 `protowire:"2,0,int64,optional"`
+		Boolean bool  `protowire:"3,0,bool,optional"`
+	}
+	type testEmbed struct {
+		TestVarint *testVarint `protowire:"1,2,embed,optional"`
+	}
+	repeated, _ := proto.Marshal(&testdata.TestRepeated{
+		Int64: []int64{1, 2},
+		Str:   []string{"a"},
+	})
+	type testRepeated struct {
+		Int64 []int64  `protowire:"1,2,int64,packed,repeated"`
+		Str   []string `protowire:"4,2,string,repeated"`
+	}
+
+	tests := []struct {
+		name string
+		opts UnmarshalOptions
+		b    []byte
+		v    interface{}
+		want interface{}
+	}{
+		{
+			name: "埋め込みメッセージはマージされ、スカラー値は後の値で上書きされる",
+			b:    append(append([]byte{}, first...), second...),
+			v:    &testEmbed{},
+			want: &testEmbed{
+				TestVarint: &testVarint{
+					Int32:   -12345,
+					Int64:   67890,
+					Boolean: true,
+				},
+			},
+		},
+		{
+			name: "repeatedは連結される",
+			b:    append(append([]byte{}, repeated...), repeated...),
+			v:    &testRepeated{},
+			want: &testRepeated{
+				Int64: []int64{1, 2, 1, 2},
+				Str:   []string{"a", "a"},
+			},
+		},
+		{
+			name: "Mergeを指定しなければSetされていた値はリセットされる",
+			b:    repeated,
+			v: &testRepeated{
+				Int64: []int64{0},
+			},
+			want: &testRepeated{
+				Int64: []int64{1, 2},
+				Str:   []string{"a"},
+			},
+		},
+		{
+			name: "Mergeを指定するとSetされていた値にマージされる",
+			opts: UnmarshalOptions{Merge: true},
+			b:    repeated,
+			v: &testRepeated{
+				Int64: []int64{0},
+			},
+			want: &testRepeated{
+				Int64: []int64{0, 1, 2},
+				Str:   []string{"a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Unmarshal(tt.b, tt.v); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.v, tt.want) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", tt.v, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_mergeRequired(t *testing.T) {
+	type requiredChild struct {
+		A int32 `protowire:"1,0,int32,required"`
+		B int32 `protowire:"2,0,int32,required"`
+	}
+	type requiredParent struct {
+		Child *requiredChild `protowire:"1,2,embed,required"`
+	}
+
+	tests := []struct {
+		name      string
+		opts      UnmarshalOptions
+		b         []byte
+		v         interface{}
+		wantPaths []string
+	}{
+		{
+			name: "マージ先でSetされているrequiredなフィールドは含まれていたものとして扱う",
+			opts: UnmarshalOptions{Merge: true},
+			b:    []byte{0x10, 0x02},
+			v:    &requiredChild{A: 5},
+		},
+		{
+			name: "埋め込みメッセージの中のフィールドもマージ先の値を考慮する",
+			opts: UnmarshalOptions{Merge: true},
+			b:    []byte{0x0a, 0x02, 0x10, 0x02},
+			v:    &requiredParent{Child: &requiredChild{A: 5}},
+		},
+		{
+			name:      "マージ先でもSetされていなければエラー",
+			opts:      UnmarshalOptions{Merge: true},
+			b:         []byte{0x10, 0x02},
+			v:         &requiredChild{},
+			wantPaths: []string{"A"},
+		},
+		{
+			name:      "Mergeを指定しなければリセットされるのでエラー",
+			b:         []byte{0x10, 0x02},
+			v:         &requiredChild{A: 5},
+			wantPaths: []string{"A"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Unmarshal(tt.b, tt.v)
+			if tt.wantPaths == nil {
+				if err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				return
+			}
+			var rerr *RequiredNotSetError
+			if !errors.As(err, &rerr) {
+				t.Fatalf("Unmarshal() error = %v, want *RequiredNotSetError", err)
+			}
+			if !reflect.DeepEqual(rerr.Paths, tt.wantPaths) {
+				t.Errorf("Unmarshal() paths = %v, want %v", rerr.Paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  interface{}
+		src  interface{}
+		want interface{}
+	}{
+		{
+			name: "スカラー値はゼロ値でなければ上書きし、埋め込みメッセージはマージし、repeatedは連結する",
+			dst: &testMerge{
+				Int32:    1,
+				Bytes:    []byte{0x01},
+				Embed:    &testMergeChild{Int32: 1},
+				Repeated: []int64{1},
+				Children: []*testMergeChild{{Str: "a"}},
+			},
+			src: &testMerge{
+				Bytes:    []byte{0x02},
+				Embed:    &testMergeChild{Str: "b"},
+				Repeated: []int64{2},
+				Children: []*testMergeChild{{Str: "b"}},
+			},
+			want: &testMerge{
+				Int32:    1,
+				Bytes:    []byte{0x02},
+				Embed:    &testMergeChild{Int32: 1, Str: "b"},
+				Repeated: []int64{1, 2},
+				Children: []*testMergeChild{{Str: "a"}, {Str: "b"}},
+			},
+		},
+		{
+			name: "nilのポインタで埋め込まれたstructはどちらにも割り当てない",
+			dst:  &testEmbeddedKinds{},
+			src:  &testEmbeddedKinds{Name: "x"},
+			want: &testEmbeddedKinds{Name: "x"},
+		},
+		{
+			name: "srcでポインタで埋め込まれたstructが割り当てられていればdstにも割り当てる",
+			dst:  &testEmbeddedStruct{},
+			src:  &testEmbeddedStruct{TestMergeChild: &TestMergeChild{Int32: 1}},
+			want: &testEmbeddedStruct{TestMergeChild: &TestMergeChild{Int32: 1}},
+		},
+		{
+			name: "同じoneofのメンバーはマージする",
+			dst:  &testOneOfKinds{Kind: &TestOneOfKinds_Embed{Embed: &TestOneOfKindsChild{Int32: 1}}},
+			src:  &testOneOfKinds{Kind: &TestOneOfKinds_Embed{Embed: &TestOneOfKindsChild{Str: "a"}}},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Embed{Embed: &TestOneOfKindsChild{Int32: 1, Str: "a"}}},
+		},
+		{
+			name: "別のoneofのメンバーは置き換え、ゼロ値でもSetする",
+			dst:  &testOneOfKinds{Kind: &TestOneOfKinds_Embed{Embed: &TestOneOfKindsChild{Int32: 1}}},
+			src:  &testOneOfKinds{Kind: &TestOneOfKinds_Enum{}},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Enum{}},
+		},
+		{
+			name: "srcのoneofがSetされていなければdstの値を保持する",
+			dst:  &testOneOfKinds{Kind: &TestOneOfKinds_Sint64{Sint64: 1}},
+			src:  &testOneOfKinds{},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Sint64{Sint64: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Merge(tt.dst, tt.src); err != nil {
+				t.Fatalf("Merge() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.dst, tt.want) {
+				t.Errorf("Merge() got = %+v, want %+v", tt.dst, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge_self(t *testing.T) {
+	// 同じ値をマージしてもrepeatedは追加する前の要素だけを連結する
+	v := &testMerge{
+		Int32:    1,
+		Repeated: []int64{1, 2},
+		Children: []*testMergeChild{{Str: "a"}},
+	}
+	if err := Merge(v, v); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	want := &testMerge{
+		Int32:    1,
+		Repeated: []int64{1, 2, 1, 2},
+		Children: []*testMergeChild{{Str: "a"}, {Str: "a"}},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("Merge() got = %+v, want %+v", v, want)
+	}
+}
+
+func TestMerge_copy(t *testing.T) {
+	src := &testMerge{
+		Bytes: []byte{0x01},
+		Embed: &testMergeChild{Int32: 1},
+	}
+	dst := &testMerge{}
+	if err := Merge(dst, src); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	// dstはsrcの値を参照しない
+	src.Bytes[0] = 0xFF
+	src.Embed.Int32 = 2
+	if dst.Bytes[0] != 0x01 || dst.Embed.Int32 != 1 {
+		t.Errorf("Merge() dst refers src values: %+v", dst)
+	}
+}
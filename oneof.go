@@ -0,0 +1,53 @@
+package protowire
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// WhichOneof は v のoneofフィールドのうち、どの実装がSetされているかをfield numberで返します
+// name にはoneofの名前か、oneofフィールドのGoのフィールド名を指定します
+// 何もSetされていない場合や、指定された名前のoneofが存在しない場合はfalseを返します
+func WhichOneof(v interface{}, name string) (num int, ok bool) {
+	pm, err := newProtoMetadata(v)
+	if err != nil {
+		return 0, false
+	}
+	for fn, ofm := range pm.oneOfFields {
+		if !ofm.matchName(name) {
+			continue
+		}
+		if ofm.isSet() {
+			return int(fn), true
+		}
+	}
+	return 0, false
+}
+
+// ClearOneof は v のoneofフィールドをnilにします
+// name にはoneofの名前か、oneofフィールドのGoのフィールド名を指定します
+func ClearOneof(v interface{}, name string) error {
+	pm, err := newProtoMetadata(v)
+	if err != nil {
+		return fmt.Errorf("failed to parse protoMetadata from input interface{}: %w", err)
+	}
+	for _, ofm := range pm.oneOfFields {
+		if !ofm.matchName(name) {
+			continue
+		}
+		// nilのポインタで埋め込まれたstructのoneofは、何もSetされていません
+		if ofm.embed.isNil() {
+			return nil
+		}
+		if !ofm.iface.CanSet() {
+			return fmt.Errorf("can't set oneof %s", ofm.name)
+		}
+		ofm.iface.Set(reflect.Zero(ofm.iface.Type()))
+		return nil
+	}
+	return fmt.Errorf("oneof %s not found", name)
+}
+
+func (n oneOfFieldName) matchName(name string) bool {
+	return n.name == name || n.goName == name
+}
@@ -1,5 +1,13 @@
 package protowire
 
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
 type testOneOf struct {
 	Name           string                     `protowire:"1,2,string,optional"`
 	TestIdentifier isTestOneOf_TestIdentifier `protowire_oneof:"true"`
@@ -37,3 +45,197 @@ type TestOneOf_BinaryMessage struct {
 }
 
 func (*TestOneOf_BinaryMessage) isTestOneOfMessage() {}
+
+type testOneOfKinds struct {
+	Kind isTestOneOfKinds_Kind `protowire_oneof:"kind"`
+}
+
+type isTestOneOfKinds_Kind interface {
+	isTestOneOfKindsKind()
+}
+
+type TestOneOfKindsChild struct {
+	Int32 int32  `protowire:"1,0,int32,optional"`
+	Str   string `protowire:"2,2,string,optional"`
+}
+
+type TestOneOfKindsEnum int32
+
+type TestOneOfKinds_Embed struct {
+	Embed *TestOneOfKindsChild `protowire:"1,2,embed,oneof"`
+}
+
+func (*TestOneOfKinds_Embed) isTestOneOfKindsKind() {}
+
+type TestOneOfKinds_Enum struct {
+	Enum TestOneOfKindsEnum `protowire:"2,0,enum,oneof"`
+}
+
+func (*TestOneOfKinds_Enum) isTestOneOfKindsKind() {}
+
+type TestOneOfKinds_Sint64 struct {
+	Sint64 int64 `protowire:"3,0,sint64,oneof"`
+}
+
+func (*TestOneOfKinds_Sint64) isTestOneOfKindsKind() {}
+
+type TestOneOfKinds_Double struct {
+	Double float64 `protowire:"4,1,double,oneof"`
+}
+
+func (*TestOneOfKinds_Double) isTestOneOfKindsKind() {}
+
+type TestOneOfKinds_Fixed32 struct {
+	Fixed32 uint32 `protowire:"5,5,fixed32,oneof"`
+}
+
+func (*TestOneOfKinds_Fixed32) isTestOneOfKindsKind() {}
+
+func TestUnmarshal_oneof(t *testing.T) {
+	embed := func(b []byte, child []byte) []byte {
+		b = wire.AppendTag(b, 1, wire.BytesType)
+		return wire.AppendBytes(b, child)
+	}
+	childInt32 := wire.AppendVarint(wire.AppendTag(nil, 1, wire.VarintType), 12345)
+	childStr := wire.AppendString(wire.AppendTag(nil, 2, wire.BytesType), "this is test")
+	enum := wire.AppendVarint(wire.AppendTag(nil, 2, wire.VarintType), 2)
+
+	tests := []struct {
+		name string
+		b    []byte
+		v    *testOneOfKinds
+		want *testOneOfKinds
+	}{
+		{
+			name: "埋め込みメッセージのoneofを読み取れる",
+			b:    embed(nil, childInt32),
+			v:    &testOneOfKinds{},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Embed{Embed: &TestOneOfKindsChild{Int32: 12345}}},
+		},
+		{
+			name: "enumのoneofを読み取れる",
+			b:    enum,
+			v:    &testOneOfKinds{},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Enum{Enum: 2}},
+		},
+		{
+			name: "sint64のoneofを読み取れる",
+			b:    wire.AppendVarint(wire.AppendTag(nil, 3, wire.VarintType), wire.EncodeZigZag(-67890)),
+			v:    &testOneOfKinds{},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Sint64{Sint64: -67890}},
+		},
+		{
+			name: "doubleのoneofを読み取れる",
+			b:    wire.AppendFixed64(wire.AppendTag(nil, 4, wire.Fixed64Type), math.Float64bits(1.23456789)),
+			v:    &testOneOfKinds{},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Double{Double: 1.23456789}},
+		},
+		{
+			name: "fixed32のoneofを読み取れる",
+			b:    wire.AppendFixed32(wire.AppendTag(nil, 5, wire.Fixed32Type), 67890),
+			v:    &testOneOfKinds{},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Fixed32{Fixed32: 67890}},
+		},
+		{
+			name: "同じ埋め込みメッセージのoneofが複数回現れるとマージする",
+			b:    embed(embed(nil, childInt32), childStr),
+			v:    &testOneOfKinds{},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Embed{Embed: &TestOneOfKindsChild{Int32: 12345, Str: "this is test"}}},
+		},
+		{
+			name: "別のoneofが現れると前の値を引き継がずに置き換える",
+			b:    embed(append(embed(nil, childInt32), enum...), childStr),
+			v:    &testOneOfKinds{},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Embed{Embed: &TestOneOfKindsChild{Str: "this is test"}}},
+		},
+		{
+			name: "すでにSetされている別のoneofは置き換える",
+			b:    enum,
+			v:    &testOneOfKinds{Kind: &TestOneOfKinds_Sint64{Sint64: 1}},
+			want: &testOneOfKinds{Kind: &TestOneOfKinds_Enum{Enum: 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Unmarshal(tt.b, tt.v); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.v, tt.want) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", tt.v.Kind, tt.want.Kind)
+			}
+		})
+	}
+}
+
+func TestWhichOneof(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		oneof   string
+		wantNum int
+		wantOk  bool
+	}{
+		{
+			name:    "Setされているoneofのfield numberを返す",
+			v:       &testOneOf{TestIdentifier: &TestOneOf_Email{Email: "test@example.com"}},
+			oneof:   "TestIdentifier",
+			wantNum: 3,
+			wantOk:  true,
+		},
+		{
+			name:    "タグで指定したoneofの名前でも探せる",
+			v:       &testOneOfKinds{Kind: &TestOneOfKinds_Enum{}},
+			oneof:   "kind",
+			wantNum: 2,
+			wantOk:  true,
+		},
+		{
+			name:    "Goのフィールド名でも探せる",
+			v:       &testOneOfKinds{Kind: &TestOneOfKinds_Embed{}},
+			oneof:   "Kind",
+			wantNum: 1,
+			wantOk:  true,
+		},
+		{
+			name:   "何もSetされていなければfalse",
+			v:      &testOneOf{TestIdentifier: &TestOneOf_Id{}},
+			oneof:  "TestMessage",
+			wantOk: false,
+		},
+		{
+			name:   "存在しないoneofはfalse",
+			v:      &testOneOf{},
+			oneof:  "Unknown",
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			num, ok := WhichOneof(tt.v, tt.oneof)
+			if num != tt.wantNum || ok != tt.wantOk {
+				t.Errorf("WhichOneof() = (%d, %v), want (%d, %v)", num, ok, tt.wantNum, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestClearOneof(t *testing.T) {
+	v := &testOneOf{
+		Name:           "test oneof",
+		TestIdentifier: &TestOneOf_Id{Id: "identifier string"},
+		TestMessage:    &TestOneOf_TextMessage{TextMessage: "message string"},
+	}
+	if err := ClearOneof(v, "TestIdentifier"); err != nil {
+		t.Fatalf("ClearOneof() error = %v", err)
+	}
+	want := &testOneOf{
+		Name:        "test oneof",
+		TestMessage: &TestOneOf_TextMessage{TextMessage: "message string"},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("ClearOneof() got = %+v, want %+v", v, want)
+	}
+	if err := ClearOneof(v, "Unknown"); err == nil {
+		t.Errorf("ClearOneof() error = nil, want error for unknown oneof")
+	}
+}
@@ -14,8 +14,10 @@ const (
 )
 
 type protoMetadata struct {
-	fields      map[fieldNumber]protoFieldMetadata
-	oneOfFields map[fieldNumber]oneOfFieldMetadata
+	fields      map[FieldNumber]protoFieldMetadata
+	oneOfFields map[FieldNumber]oneOfFieldMetadata
+	// extensions はメッセージが拡張フィールドを受け付ける場合にその保持先の情報を持ちます
+	extensions *extensionsMetadata
 }
 
 // newProtoMetadata はstructの情報を読み取り、wireのパースに必要な情報を生成します
@@ -29,92 +31,450 @@ func newProtoMetadata(v interface{}) (protoMetadata, error) {
 		return protoMetadata{}, errors.New("target value must be a struct")
 	}
 	pm := protoMetadata{
-		fields:      make(map[fieldNumber]protoFieldMetadata),
-		oneOfFields: make(map[fieldNumber]oneOfFieldMetadata),
+		fields:      make(map[FieldNumber]protoFieldMetadata),
+		oneOfFields: make(map[FieldNumber]oneOfFieldMetadata),
 	}
+	if err := pm.readStruct(reflect.ValueOf(v).Elem(), nil); err != nil {
+		return protoMetadata{}, err
+	}
+	return pm, nil
+}
+
+// readStruct はstructの各フィールドを読み取って pm に追加します
+// タグのない匿名フィールド(埋め込みstruct)は再帰的に読み取り、そのフィールドを同じメッセージのフィールドとして平坦化します
+// ep は rv がnilのポインタで埋め込まれたstructの場合の割り当て先で、そうでなければnilです
+func (pm *protoMetadata) readStruct(rv reflect.Value, ep *embeddedPointer) error {
+	rt := rv.Type()
 	for i := 0; i < rt.NumField(); i++ {
 		f := rt.Field(i)
 		// protobuf_oneof タグには該当フィールドがoneofかどうかの情報が入ります
-		if t := f.Tag.Get(protoOneOfTag); t == "true" {
-			oneOfFields, err := getOneOfFieldMetadataByIface(reflect.ValueOf(v).Elem().Field(i))
+		name, ok, err := oneOfName(f)
+		if err != nil {
+			return err
+		}
+		if ok {
+			oneOfFields, err := getOneOfFieldMetadataByIface(name, rv.Field(i))
 			if err != nil {
-				return protoMetadata{}, fmt.Errorf("failed to get oneof fields: %w", err)
+				return fmt.Errorf("failed to get oneof fields: %w", err)
 			}
 			for fn, ofm := range oneOfFields {
+				if err := pm.checkDuplicate(fn); err != nil {
+					return err
+				}
+				ofm.embed = ep
 				pm.oneOfFields[fn] = ofm
 			}
 			continue
 		}
-		fn, fm, err := newProtoFieldMetadata(f, reflect.ValueOf(v).Elem().Field(i))
+		if _, ok := f.Tag.Lookup(protoExtensionsTag); ok {
+			em, err := newExtensionsMetadata(f, rv.Field(i))
+			if err != nil {
+				return fmt.Errorf("failed to read extensions field: %w", err)
+			}
+			if pm.extensions != nil {
+				return errors.New("duplicate extensions field")
+			}
+			em.embed = ep
+			pm.extensions = em
+			continue
+		}
+		if f.Anonymous {
+			if _, ok := f.Tag.Lookup(protoTag); !ok {
+				embedded, embeddedEp, err := embeddedStruct(f, rv.Field(i), ep)
+				if err != nil {
+					return err
+				}
+				if err := pm.readStruct(embedded, embeddedEp); err != nil {
+					return fmt.Errorf("failed to read embedded struct %s: %w", f.Name, err)
+				}
+				continue
+			}
+		}
+		fn, fm, err := newProtoFieldMetadata(f, rv.Field(i))
 		if err != nil {
-			return protoMetadata{}, fmt.Errorf("failed to create struct field: %w", err)
+			return fmt.Errorf("failed to create struct field: %w", err)
 		}
+		if err := pm.checkDuplicate(fn); err != nil {
+			return err
+		}
+		fm.embed = ep
 		pm.fields[fn] = fm
 	}
-	return pm, nil
+	return nil
+}
+
+// checkDuplicate は埋め込みstructやoneofを平坦化した結果、field numberが重複していないかを確認します
+func (pm protoMetadata) checkDuplicate(fn FieldNumber) error {
+	_, inFields := pm.fields[fn]
+	_, inOneOfFields := pm.oneOfFields[fn]
+	if inFields || inOneOfFields {
+		return fmt.Errorf("duplicate field number: %d", fn)
+	}
+	return nil
+}
+
+// embeddedStruct は匿名フィールドとして埋め込まれたstructの reflect.Value と、その割り当て先を返します
+// ポインタで埋め込まれていてnilの場合は、親のstructを書き換えないように別に確保したstructを返し、
+// その中のフィールドに値をSetするときに embeddedPointer.alloc で割り当てます
+func embeddedStruct(f reflect.StructField, rv reflect.Value, ep *embeddedPointer) (reflect.Value, *embeddedPointer, error) {
+	switch {
+	case f.Type.Kind() == reflect.Struct:
+		return rv, ep, nil
+	case f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct:
+		if !rv.IsNil() {
+			return rv.Elem(), ep, nil
+		}
+		value := reflect.New(f.Type.Elem())
+		return value.Elem(), &embeddedPointer{field: rv, value: value, outer: ep}, nil
+	default:
+		return reflect.Value{}, nil, fmt.Errorf("embedded field must be a struct or a pointer to struct, but %s", f.Type.String())
+	}
+}
+
+// embeddedPointer はnilのポインタで埋め込まれたstructの割り当て先です
+// field は埋め込まれたポインタのフィールドで、 value はその中のフィールドのメタデータを作るために確保したstructのポインタです
+// outer はさらに外側のstructもnilのポインタで埋め込まれている場合の割り当て先です
+//
+// nilの embeddedPointer は埋め込まれたstructがすでに割り当てられていることを表します
+type embeddedPointer struct {
+	field reflect.Value
+	value reflect.Value
+	outer *embeddedPointer
+}
+
+// alloc は埋め込まれたポインタがnilであれば、外側から順に value を割り当てます
+// 埋め込まれたstructのフィールドに値をSetする前に呼び出します
+func (ep *embeddedPointer) alloc() error {
+	if ep == nil {
+		return nil
+	}
+	if err := ep.outer.alloc(); err != nil {
+		return err
+	}
+	if !ep.field.IsNil() {
+		return nil
+	}
+	if !ep.field.CanSet() {
+		return fmt.Errorf("can't set embedded pointer to unexported struct: %s", ep.field.Type().String())
+	}
+	ep.field.Set(ep.value)
+	return nil
+}
+
+// isNil は埋め込まれたポインタがまだ割り当てられていないかを返します
+// 割り当てられていないstructのフィールドはすべてゼロ値です
+func (ep *embeddedPointer) isNil() bool {
+	return ep != nil && ep.field.IsNil()
 }
 
 // protoFieldMetadata は `protowire` タグの内容やそのフィールドの reflect.Value などの、wireのパースに必要なメタデータを表します
 type protoFieldMetadata struct {
-	wt  wireType
+	wt  WireType
 	pt  protoType
 	fts fieldTypes
 	rv  reflect.Value
+
+	// name はprotoのフィールド名で、エラーやデバッグ出力に利用します。タグで指定されていない場合はGoのフィールド名です
+	name string
+	// jsonName はJSONにマッピングする場合のフィールド名です
+	jsonName   string
+	deprecated bool
+	// noUTF8 が true の場合、stringの値がUTF-8として正しいかを検証しません。proto2のstringのように検証しないフィールドに指定します
+	noUTF8 bool
+	// def はタグで指定されたデフォルト値で、指定されていない場合は無効な reflect.Value です
+	def reflect.Value
+	// embed はフィールドがnilのポインタで埋め込まれたstructのフィールドの場合に、値をSetする前に割り当てる先です
+	embed *embeddedPointer
+}
+
+func (fm protoFieldMetadata) String() string {
+	s := fmt.Sprintf("%s(wire type: %d, proto type: %s, field types: %s", fm.name, fm.wt, fm.pt, fm.fts)
+	if fm.jsonName != "" {
+		s += ", json: " + fm.jsonName
+	}
+	if fm.def.IsValid() {
+		s += fmt.Sprintf(", default: %v", fm.def)
+	}
+	if fm.deprecated {
+		s += ", deprecated"
+	}
+	if fm.noUTF8 {
+		s += ", noutf8"
+	}
+	return s + ")"
+}
+
+// label はエラーメッセージでフィールドを示す文字列で、protoのフィールド名にJSONにマッピングする場合の名前とdeprecatedかどうかを併記します
+// e.g. `user_id (json: userId, deprecated)`
+func (fm protoFieldMetadata) label() string {
+	var notes []string
+	if fm.jsonName != "" {
+		notes = append(notes, "json: "+fm.jsonName)
+	}
+	if fm.deprecated {
+		notes = append(notes, "deprecated")
+	}
+	if len(notes) == 0 {
+		return fm.name
+	}
+	return fmt.Sprintf("%s (%s)", fm.name, strings.Join(notes, ", "))
+}
+
+// isRepeatedScalar はフィールドがpackedとunpackedのどちらでもエンコードされうるrepeatedなスカラー値かを返します
+func (fm protoFieldMetadata) isRepeatedScalar() bool {
+	if !isRepeatedType(fm.rv.Type()) {
+		return false
+	}
+	ptwt, err := fm.pt.toWireType()
+	return err == nil && ptwt.Packable()
 }
 
 // newProtoFieldMetadata はstructに振られた `protowire` タグ情報や、
 // そのフィールドに値をSetするための reflect.Value 値などからmetadataを生成します
-func newProtoFieldMetadata(f reflect.StructField, rv reflect.Value) (fieldNumber, protoFieldMetadata, error) {
-	t := strings.Split(f.Tag.Get(protoTag), ",")
-	if len(t) < 4 {
-		return 0, protoFieldMetadata{}, fmt.Errorf("invalid struct tag length, len: %d", len(t))
+//
+// タグは `field number,wire type,proto type,field types...` の形式で記述しますが、
+// wire typeはproto typeから、proto typeとfield typesはフィールドのGoの型から推論できるので省略できます
+// e.g. `protowire:"1,0,int32,optional"`, `protowire:"1,int32"`, `protowire:"1"`
+//
+// また `key=value` の形式で値を指定することもでき、位置による指定と組み合わせることもできます
+// e.g. `protowire:"num=3,type=sint64,name=user_id,packed,deprecated"`
+//   - num: field number
+//   - wire: wire type
+//   - type: proto type
+//   - name: protoのフィールド名
+//   - json_name: JSONにマッピングする場合のフィールド名。省略した場合はnameをlowerCamelCaseにしたもの。 json とも書けます
+//   - def: デフォルト値。値にカンマを含められるように、タグの最後に指定する必要があります
+//
+// 値を持たない `deprecated` と、stringのUTF-8の検証を行わない `noutf8` も指定できます
+func newProtoFieldMetadata(f reflect.StructField, rv reflect.Value) (FieldNumber, protoFieldMetadata, error) {
+	tag := f.Tag.Get(protoTag)
+	fm := protoFieldMetadata{
+		name: f.Name,
+		rv:   rv,
+	}
+	// def= はタグの最後に指定するので、 def= で始まる最初の要素から後ろはカンマや def= を含めてすべてデフォルト値です
+	var def *string
+	parts := strings.Split(tag, ",")
+	for i, v := range parts {
+		if strings.HasPrefix(v, "def=") {
+			s := strings.TrimPrefix(strings.Join(parts[i:], ","), "def=")
+			def = &s
+			tag = strings.Join(parts[:i], ",")
+			break
+		}
 	}
-	fn, err := strconv.Atoi(t[0])
+
+	var (
+		fnStr, wtStr string
+		positional   []string
+	)
+	for _, v := range strings.Split(tag, ",") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) == 1 {
+			switch v {
+			case "deprecated":
+				fm.deprecated = true
+				continue
+			case "noutf8":
+				fm.noUTF8 = true
+				continue
+			}
+			positional = append(positional, v)
+			continue
+		}
+		switch key, val := kv[0], kv[1]; key {
+		case "num":
+			fnStr = val
+		case "wire":
+			wtStr = val
+		case "type":
+			fm.pt = protoType(val)
+		case "name":
+			fm.name = val
+		case "json_name", "json":
+			fm.jsonName = val
+		default:
+			return 0, protoFieldMetadata{}, fmt.Errorf("unknown tag key: %s", key)
+		}
+	}
+	if fm.jsonName == "" && fm.name != f.Name {
+		fm.jsonName = jsonCamelCase(fm.name)
+	}
+
+	if fnStr == "" && len(positional) > 0 {
+		fnStr, positional = positional[0], positional[1:]
+	}
+	fn, err := strconv.Atoi(fnStr)
 	if err != nil {
-		return 0, protoFieldMetadata{}, err
+		return 0, protoFieldMetadata{}, fmt.Errorf("invalid field number: %w", err)
 	}
-	if fn > 1<<29-1 {
+	if fn > int(MaxValidNumber) {
 		return 0, protoFieldMetadata{}, errors.New("invalid protoFieldMetadata, largest field_number is 536,870,911")
 	}
-	wt, err := strconv.Atoi(t[1])
-	if wt > 7 {
-		return 0, protoFieldMetadata{}, errors.New("invalid protoFieldMetadata, largest type is 7")
+	if !FieldNumber(fn).IsValid() {
+		return 0, protoFieldMetadata{}, fmt.Errorf("invalid protoFieldMetadata, field_number must be positive, but %d", fn)
+	}
+
+	// wire typeは数値で指定されている場合のみ読み取ります
+	if wtStr == "" && len(positional) > 0 {
+		if _, err := strconv.Atoi(positional[0]); err == nil {
+			wtStr, positional = positional[0], positional[1:]
+		}
 	}
-	pt := protoType(t[2])
-	fts := make([]fieldType, len(t[3:]))
-	for i, v := range t[3:] {
+	hasWt := wtStr != ""
+	if hasWt {
+		wt, err := strconv.Atoi(wtStr)
+		if err != nil {
+			return 0, protoFieldMetadata{}, fmt.Errorf("invalid wire type: %w", err)
+		}
+		if wt > 7 {
+			return 0, protoFieldMetadata{}, errors.New("invalid protoFieldMetadata, largest type is 7")
+		}
+		fm.wt = WireType(wt)
+	}
+	// 4つの値を指定する形式では不明なproto typeもproto typeとして読み取り、後続のエラーで検出します
+	if fm.pt == "" && len(positional) > 0 && (hasWt || protoType(positional[0]).isValid()) {
+		fm.pt, positional = protoType(positional[0]), positional[1:]
+	}
+	for _, v := range positional {
 		ft, err := newFieldType(v)
 		if err != nil {
 			return 0, protoFieldMetadata{}, fmt.Errorf("invalid field type: %w", err)
 		}
-		fts[i] = ft
+		fm.fts = append(fm.fts, ft)
 	}
 
-	fm := protoFieldMetadata{
-		wt:  wireType(wt),
-		pt:  pt,
-		fts: fts,
-		rv:  rv,
+	if fm.pt == "" {
+		fm.pt, err = inferProtoType(f.Type)
+		if err != nil {
+			return 0, protoFieldMetadata{}, fmt.Errorf("failed to infer proto type: %w", err)
+		}
+	}
+	if len(fm.fts) == 0 {
+		fm.fts = inferFieldTypes(f.Type, fm.pt)
+	}
+	// packedはrepeatedなフィールドにしか指定できないので、sliceに対してrepeatedが省略されていれば補います
+	if fm.fts.Has(fieldPacked) && !fm.fts.Has(fieldRepeated) && f.Type.Kind() == reflect.Slice {
+		fm.fts = append(fm.fts, fieldRepeated)
+	}
+	ptwt, err := fm.pt.toWireType()
+	if err != nil {
+		return 0, protoFieldMetadata{}, fmt.Errorf("failed to convert proto type to wire type: %w", err)
+	}
+	if !hasWt {
+		fm.wt = ptwt
+		if fm.fts.Has(fieldPacked) {
+			fm.wt = WireLengthDelimited
+		}
+	}
+	// packed repeated fieldsはlength delimitedとして宣言できるので、それ以外でwire typeとproto typeが一致しない場合はエラー
+	if fm.wt != ptwt && !(fm.fts.Has(fieldPacked) && fm.wt == WireLengthDelimited) {
+		return 0, protoFieldMetadata{}, fmt.Errorf("wire type %d disagrees with proto type %s, want %d", fm.wt, fm.pt, ptwt)
 	}
-	return fieldNumber(fn), fm, nil
+	if def != nil {
+		fm.def, err = parseDefault(fm.pt, f.Type, *def)
+		if err != nil {
+			return 0, protoFieldMetadata{}, fmt.Errorf("failed to parse default value: %w", err)
+		}
+	}
+	return FieldNumber(fn), fm, nil
+}
+
+// jsonCamelCase はprotocと同じ規則でprotoのフィールド名をJSONのフィールド名に変換します
+// アンダースコアを取り除き、その直後の文字を大文字にします
+func jsonCamelCase(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper && 'a' <= r && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// oneOfFieldName はoneofフィールドの名前です
+// `protowire_oneof` タグには `true` の代わりにoneofの名前を指定でき、エラーやツールでの表示に利用します
+// 名前が指定されていない場合、 name はGoのフィールド名です
+type oneOfFieldName struct {
+	name   string
+	goName string
+}
+
+// oneOfName は `protowire_oneof` タグからoneofの名前を読み取ります。oneofフィールドでなければfalseを返します
+// タグの値は "true" か "false"、またはoneofの名前で、 "true" の場合はGoのフィールド名をoneofの名前とします
+// oneofの名前はprotoの識別子として正しい必要があり、それ以外の値はエラーにします
+func oneOfName(f reflect.StructField) (oneOfFieldName, bool, error) {
+	t := f.Tag.Get(protoOneOfTag)
+	switch {
+	case t == "" || t == "false":
+		return oneOfFieldName{}, false, nil
+	case t == "true":
+		return oneOfFieldName{name: f.Name, goName: f.Name}, true, nil
+	case !isProtoIdent(t):
+		return oneOfFieldName{}, false, fmt.Errorf("invalid %s tag %q, must be \"true\", \"false\" or a oneof name", protoOneOfTag, t)
+	default:
+		return oneOfFieldName{name: t, goName: f.Name}, true, nil
+	}
+}
+
+// isProtoIdent は s がprotoの識別子として正しいか(英字かアンダースコアで始まり、英数字とアンダースコアだけからなるか)を返します
+func isProtoIdent(s string) bool {
+	for i, c := range s {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && '0' <= c && c <= '9':
+		default:
+			return false
+		}
+	}
+	return s != ""
 }
 
 // oneOfFieldMetadata はoneofをパースするためにinterfaceやその実装の情報とstructのフィールド定義を持ちます
 // interfaceを実装するimplementの型はフィールド数1のstructである必要があります
 // implementは実装のポインタであり、structFieldは実装のstructのフィールド情報です
 // ifaceはstructから読み取ったoneofフィールドの値であり、ここに値をSetすれば元の構造の値が更新されます。手順は以下です
-// 1: protoFieldMetadata.rv にセット
-// 2: 1で implement が更新されるので iface に implement をセット
+// 1: bindImplement で値をbindする実装を決め、その実装のフィールドにセット
+// 2: 1で実装が更新されるので iface に実装をセット
 type oneOfFieldMetadata struct {
+	oneOfFieldName
 	iface              reflect.Value
 	implement          reflect.Value
 	protoFieldMetadata protoFieldMetadata
+	// embed はoneofフィールドがnilのポインタで埋め込まれたstructのフィールドの場合に、値をSetする前に割り当てる先です
+	embed *embeddedPointer
+}
+
+// isSet はoneofフィールドにこの実装がSetされているかを返します
+func (ofm oneOfFieldMetadata) isSet() bool {
+	impl := ofm.iface.Elem()
+	return impl.IsValid() && impl.Type() == ofm.implement.Type() && !impl.IsNil()
+}
+
+// bindImplement はoneofフィールドの値をbindする実装と、その実装のフィールドを指す protoFieldMetadata を返します
+// iface にすでに同じ実装がSetされていればそれを再利用するので、埋め込みメッセージは前の値にマージされ、スカラー値は後の値で上書きされます
+// 別の実装がSetされていれば、前の値を引き継がないように新しい実装を確保して置き換えます
+func (ofm oneOfFieldMetadata) bindImplement() (reflect.Value, protoFieldMetadata) {
+	impl := ofm.iface.Elem()
+	if !ofm.isSet() {
+		impl = reflect.New(ofm.implement.Type().Elem())
+	}
+	fm := ofm.protoFieldMetadata
+	fm.rv = impl.Elem().Field(0)
+	return impl, fm
 }
 
 // getOneOfFieldMetadataByIface はあるoneofフィールドに代入される可能性のあるすべての構造の情報を読み取ります
 // 実装上oneofのフィールドはinterfaceとなっており、その実装としていくつかのstructが存在することを想定しています
 // あるoneofフィールドを実装しているstructをすべて読み取り、そのstructのタグ情報や、値の代入のためのreflect.Valueの取得などを行います
-func getOneOfFieldMetadataByIface(iface reflect.Value) (map[fieldNumber]oneOfFieldMetadata, error) {
+func getOneOfFieldMetadataByIface(name oneOfFieldName, iface reflect.Value) (map[FieldNumber]oneOfFieldMetadata, error) {
 	ifaceTyp := iface.Type()
 	if ifaceTyp.Kind() != reflect.Interface {
 		return nil, fmt.Errorf("oneof field type must be interface, but %s", ifaceTyp.Kind().String())
@@ -123,7 +483,7 @@ func getOneOfFieldMetadataByIface(iface reflect.Value) (map[fieldNumber]oneOfFie
 	if err != nil {
 		return nil, fmt.Errorf("failed to get %s implements: %w", ifaceTyp.String(), err)
 	}
-	oneOfFields := make(map[fieldNumber]oneOfFieldMetadata, len(rvs))
+	oneOfFields := make(map[FieldNumber]oneOfFieldMetadata, len(rvs))
 	for _, rv := range rvs {
 		rt := rv.Type()
 		if rt.Kind() == reflect.Ptr {
@@ -140,9 +500,10 @@ func getOneOfFieldMetadataByIface(iface reflect.Value) (map[fieldNumber]oneOfFie
 			return nil, fmt.Errorf("failed to parse oneof struct field: %w", err)
 		}
 		if !fm.fts.Has(fieldOneOf) {
-			return nil, fmt.Errorf("oneof field type must be fieldOneOf, but %s", fm.fts)
+			return nil, fmt.Errorf("oneof %s field type must be fieldOneOf, but %s", name.name, fm.fts)
 		}
 		oneOfFields[fieldNum] = oneOfFieldMetadata{
+			oneOfFieldName:     name,
 			iface:              iface,
 			implement:          rv,
 			protoFieldMetadata: fm,
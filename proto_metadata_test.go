@@ -2,6 +2,7 @@ package protowire
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -17,9 +18,47 @@ func Test_newProtoMetadata(t *testing.T) {
 	type invalidFieldNumber struct {
 		Age int32 `protowire:"536870912,0,int32,optional"`
 	}
+	type negativeFieldNumber struct {
+		Age int32 `protowire:"-1,0,int32,optional"`
+	}
 	type invalidType struct {
 		Age int32 `protowire:"1,8,xxx,optional"`
 	}
+	type shorthandTest struct {
+		Age    int32    `protowire:"1,sint32"`
+		Name   string   `protowire:"2"`
+		Score  float64  `protowire:"3"`
+		Bytes  []byte   `protowire:"4"`
+		Embed  *tagTest `protowire:"5"`
+		IDs    []int64  `protowire:"6"`
+		Tags   []string `protowire:"7"`
+		Others []int64  `protowire:"8,int64,repeated"`
+	}
+	type contradictionTest struct {
+		Age int32 `protowire:"1,2,int32,optional"`
+	}
+	type uninferableTest struct {
+		Age int `protowire:"1"`
+	}
+	type embeddedHeader struct {
+		ID int64 `protowire:"1,0,int64,optional"`
+	}
+	type embeddedStructTest struct {
+		embeddedHeader
+		Name string `protowire:"2,2,string,optional"`
+	}
+	type EmbeddedPointer struct {
+		Age  int32  `protowire:"1,0,int32,optional"`
+		Name string `protowire:"2,2,string,optional"`
+	}
+	type embeddedPointerTest struct {
+		*EmbeddedPointer
+		ID int64 `protowire:"3,0,int64,optional"`
+	}
+	type duplicateEmbeddedTest struct {
+		embeddedHeader
+		Dup int32 `protowire:"1,0,int32,optional"`
+	}
 
 	tests := []struct {
 		name    string
@@ -31,21 +70,21 @@ func Test_newProtoMetadata(t *testing.T) {
 			name: "タグの値を読み取れる",
 			v:    &tagTest{},
 			want: protoMetadata{
-				fields: map[fieldNumber]protoFieldMetadata{
+				fields: map[FieldNumber]protoFieldMetadata{
 					1: {
-						wt:  wireVarint,
+						wt:  WireVarint,
 						pt:  protoInt32,
 						fts: fieldTypes{fieldOptional},
 						rv:  reflect.ValueOf(int32(0)),
 					},
 					2: {
-						wt:  wireLengthDelimited,
+						wt:  WireLengthDelimited,
 						pt:  protoString,
 						fts: fieldTypes{fieldOptional},
 						rv:  reflect.ValueOf(""),
 					},
 					536870911: {
-						wt:  wireLengthDelimited,
+						wt:  WireLengthDelimited,
 						pt:  protoString,
 						fts: fieldTypes{fieldOptional},
 						rv:  reflect.ValueOf(""),
@@ -58,9 +97,9 @@ func Test_newProtoMetadata(t *testing.T) {
 			name: "fieldTypeが複数の場合も読み取れる",
 			v:    &multipleFieldTypeTest{},
 			want: protoMetadata{
-				fields: map[fieldNumber]protoFieldMetadata{
+				fields: map[FieldNumber]protoFieldMetadata{
 					1: {
-						wt:  wireVarint,
+						wt:  WireVarint,
 						pt:  protoInt32,
 						fts: fieldTypes{fieldRepeated, fieldPacked},
 						rv:  reflect.ValueOf([]int32(nil)),
@@ -73,20 +112,20 @@ func Test_newProtoMetadata(t *testing.T) {
 			name: "タグにoneofが指定されていた場合はその実装なども読み取る",
 			v:    &testOneOf{},
 			want: protoMetadata{
-				fields: map[fieldNumber]protoFieldMetadata{
+				fields: map[FieldNumber]protoFieldMetadata{
 					1: {
-						wt:  wireLengthDelimited,
+						wt:  WireLengthDelimited,
 						pt:  protoString,
 						fts: fieldTypes{fieldOptional},
 						rv:  reflect.ValueOf(""),
 					},
 				},
-				oneOfFields: map[fieldNumber]oneOfFieldMetadata{
+				oneOfFields: map[FieldNumber]oneOfFieldMetadata{
 					2: {
 						iface:     reflect.New(reflect.TypeOf((*isTestOneOf_TestIdentifier)(nil)).Elem()).Elem(),
 						implement: reflect.ValueOf(&TestOneOf_Id{}),
 						protoFieldMetadata: protoFieldMetadata{
-							wt:  wireLengthDelimited,
+							wt:  WireLengthDelimited,
 							pt:  protoString,
 							fts: fieldTypes{fieldOneOf},
 							rv:  reflect.ValueOf(""),
@@ -96,7 +135,7 @@ func Test_newProtoMetadata(t *testing.T) {
 						iface:     reflect.New(reflect.TypeOf((*isTestOneOf_TestIdentifier)(nil)).Elem()).Elem(),
 						implement: reflect.ValueOf(&TestOneOf_Email{}),
 						protoFieldMetadata: protoFieldMetadata{
-							wt:  wireLengthDelimited,
+							wt:  WireLengthDelimited,
 							pt:  protoString,
 							fts: fieldTypes{fieldOneOf},
 							rv:  reflect.ValueOf(""),
@@ -106,7 +145,7 @@ func Test_newProtoMetadata(t *testing.T) {
 						iface:     reflect.New(reflect.TypeOf((*isTestOneOf_TestMessage)(nil)).Elem()).Elem(),
 						implement: reflect.ValueOf(&TestOneOf_TextMessage{}),
 						protoFieldMetadata: protoFieldMetadata{
-							wt:  wireLengthDelimited,
+							wt:  WireLengthDelimited,
 							pt:  protoString,
 							fts: fieldTypes{fieldOneOf},
 							rv:  reflect.ValueOf(""),
@@ -116,7 +155,7 @@ func Test_newProtoMetadata(t *testing.T) {
 						iface:     reflect.New(reflect.TypeOf((*isTestOneOf_TestMessage)(nil)).Elem()).Elem(),
 						implement: reflect.ValueOf(&TestOneOf_BinaryMessage{}),
 						protoFieldMetadata: protoFieldMetadata{
-							wt:  wireLengthDelimited,
+							wt:  WireLengthDelimited,
 							pt:  protoBytes,
 							fts: fieldTypes{fieldOneOf},
 							rv:  reflect.ValueOf([]byte{}),
@@ -125,6 +164,129 @@ func Test_newProtoMetadata(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "省略したタグはGoの型から推論する",
+			v:    &shorthandTest{},
+			want: protoMetadata{
+				fields: map[FieldNumber]protoFieldMetadata{
+					1: {
+						wt:  WireVarint,
+						pt:  protoSint32,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(int32(0)),
+					},
+					2: {
+						wt:  WireLengthDelimited,
+						pt:  protoString,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(""),
+					},
+					3: {
+						wt:  WireFixed64,
+						pt:  protoDouble,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(float64(0)),
+					},
+					4: {
+						wt:  WireLengthDelimited,
+						pt:  protoBytes,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf([]byte(nil)),
+					},
+					5: {
+						wt:  WireLengthDelimited,
+						pt:  protoEmbed,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(&tagTest{}),
+					},
+					6: {
+						wt:  WireLengthDelimited,
+						pt:  protoInt64,
+						fts: fieldTypes{fieldPacked, fieldRepeated},
+						rv:  reflect.ValueOf([]int64(nil)),
+					},
+					7: {
+						wt:  WireLengthDelimited,
+						pt:  protoString,
+						fts: fieldTypes{fieldRepeated},
+						rv:  reflect.ValueOf([]string(nil)),
+					},
+					8: {
+						wt:  WireVarint,
+						pt:  protoInt64,
+						fts: fieldTypes{fieldRepeated},
+						rv:  reflect.ValueOf([]int64(nil)),
+					},
+				},
+				oneOfFields: nil,
+			},
+		},
+		{
+			name:    "wire typeとproto typeが矛盾しているとエラー",
+			v:       &contradictionTest{},
+			want:    protoMetadata{},
+			wantErr: true,
+		},
+		{
+			name:    "Goの型からproto typeを推論できないとエラー",
+			v:       &uninferableTest{},
+			want:    protoMetadata{},
+			wantErr: true,
+		},
+		{
+			name: "埋め込みstructのフィールドは同じメッセージのフィールドとして読み取る",
+			v:    &embeddedStructTest{},
+			want: protoMetadata{
+				fields: map[FieldNumber]protoFieldMetadata{
+					1: {
+						wt:  WireVarint,
+						pt:  protoInt64,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(int64(0)),
+					},
+					2: {
+						wt:  WireLengthDelimited,
+						pt:  protoString,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(""),
+					},
+				},
+				oneOfFields: nil,
+			},
+		},
+		{
+			name: "ポインタで埋め込まれたstructのフィールドも読み取る",
+			v:    &embeddedPointerTest{},
+			want: protoMetadata{
+				fields: map[FieldNumber]protoFieldMetadata{
+					1: {
+						wt:  WireVarint,
+						pt:  protoInt32,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(int32(0)),
+					},
+					2: {
+						wt:  WireLengthDelimited,
+						pt:  protoString,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(""),
+					},
+					3: {
+						wt:  WireVarint,
+						pt:  protoInt64,
+						fts: fieldTypes{fieldOptional},
+						rv:  reflect.ValueOf(int64(0)),
+					},
+				},
+				oneOfFields: nil,
+			},
+		},
+		{
+			name:    "埋め込みstructとfield numberが重複しているとエラー",
+			v:       &duplicateEmbeddedTest{},
+			want:    protoMetadata{},
+			wantErr: true,
+		},
 		{
 			name:    "vがポインタじゃないとエラー",
 			v:       tagTest{},
@@ -137,6 +299,12 @@ func Test_newProtoMetadata(t *testing.T) {
 			want:    protoMetadata{},
 			wantErr: true,
 		},
+		{
+			name:    "field numberが負の値だとエラー",
+			v:       &negativeFieldNumber{},
+			want:    protoMetadata{},
+			wantErr: true,
+		},
 		{
 			name:    "field numberが上限より大きいとエラー",
 			v:       &invalidType{},
@@ -184,3 +352,290 @@ func Test_newProtoMetadata(t *testing.T) {
 		})
 	}
 }
+
+// testEmbeddedKinds は非公開の型のstructをポインタで埋め込んでいて、埋め込まれたポインタには外から値をSetできません
+type testEmbeddedKinds struct {
+	*testEmbeddedKindsHeader
+	Name string `protowire:"10,2,string,optional"`
+}
+
+type testEmbeddedKindsHeader struct {
+	ID   int32                 `protowire:"11,0,int32,optional"`
+	Kind isTestOneOfKinds_Kind `protowire_oneof:"kind"`
+}
+
+func Test_newProtoMetadata_embeddedPointer(t *testing.T) {
+	v := &testEmbeddedKinds{}
+	if _, err := newProtoMetadata(v); err != nil {
+		t.Fatalf("newProtoMetadata() error = %v", err)
+	}
+	if v.testEmbeddedKindsHeader != nil {
+		t.Errorf("newProtoMetadata() allocates embedded pointer: %+v", v.testEmbeddedKindsHeader)
+	}
+
+	// 値を読み取るだけの関数は、nilのポインタで埋め込まれたstructを割り当てない
+	if num, ok := WhichOneof(v, "kind"); ok {
+		t.Errorf("WhichOneof() = (%d, %v), want (0, false)", num, ok)
+	}
+	if err := ClearOneof(v, "kind"); err != nil {
+		t.Errorf("ClearOneof() error = %v", err)
+	}
+	if err := Merge(&testEmbeddedKinds{}, v); err != nil {
+		t.Errorf("Merge() error = %v", err)
+	}
+	if v.testEmbeddedKindsHeader != nil {
+		t.Errorf("read-only functions allocate embedded pointer: %+v", v.testEmbeddedKindsHeader)
+	}
+
+	// 埋め込まれたstructのフィールドがバイト列に含まれていなければ割り当てない
+	if err := Unmarshal([]byte{0x52, 0x01, 'a'}, v); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if want := (&testEmbeddedKinds{Name: "a"}); !reflect.DeepEqual(v, want) {
+		t.Errorf("Unmarshal() got = %+v, want %+v", v, want)
+	}
+	// 埋め込まれたstructのフィールドを読み取る場合は割り当てる必要があるので、Setできなければエラー
+	if err := Unmarshal([]byte{0x58, 0x01}, v); err == nil {
+		t.Errorf("Unmarshal() error = nil, want error for unexported embedded pointer")
+	}
+}
+
+func Test_oneOfName(t *testing.T) {
+	type oneOfNameTest struct {
+		True    isTestOneOfKinds_Kind `protowire_oneof:"true"`
+		Named   isTestOneOfKinds_Kind `protowire_oneof:"kind"`
+		False   int32                 `protowire:"1" protowire_oneof:"false"`
+		NoTag   int32                 `protowire:"2"`
+		Invalid isTestOneOfKinds_Kind `protowire_oneof:"my-kind"`
+	}
+	rt := reflect.TypeOf(oneOfNameTest{})
+
+	tests := []struct {
+		name    string
+		field   string
+		want    oneOfFieldName
+		wantOk  bool
+		wantErr bool
+	}{
+		{
+			name:   "trueの場合はGoのフィールド名をoneofの名前とする",
+			field:  "True",
+			want:   oneOfFieldName{name: "True", goName: "True"},
+			wantOk: true,
+		},
+		{
+			name:   "oneofの名前を指定できる",
+			field:  "Named",
+			want:   oneOfFieldName{name: "kind", goName: "Named"},
+			wantOk: true,
+		},
+		{
+			name:  "falseの場合はoneofではない",
+			field: "False",
+		},
+		{
+			name:  "タグがなければoneofではない",
+			field: "NoTag",
+		},
+		{
+			name:    "protoの識別子として正しくない名前はエラー",
+			field:   "Invalid",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _ := rt.FieldByName(tt.field)
+			got, ok, err := oneOfName(f)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("oneOfName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("oneOfName() = (%+v, %v), want (%+v, %v)", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	// falseが指定されたフィールドは通常のフィールドとして読み取れる
+	type falseOneOf struct {
+		Int32 int32 `protowire:"1,0,int32,optional" protowire_oneof:"false"`
+	}
+	var v falseOneOf
+	if err := Unmarshal([]byte{0x08, 0x01}, &v); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if v.Int32 != 1 {
+		t.Errorf("Unmarshal() got = %+v, want {Int32:1}", v)
+	}
+}
+
+func Test_newProtoFieldMetadata(t *testing.T) {
+	type namedTagTest struct {
+		UserID      []int64 `protowire:"num=3,type=sint64,name=user_id,packed,deprecated"`
+		JSONName    string  `protowire:"4,2,string,optional,name=display_name,json=displayName2"`
+		Default     string  `protowire:"5,string,def=hello, world"`
+		NoName      int32   `protowire:"num=6"`
+		UnknownKey  int32   `protowire:"num=7,foo=bar"`
+		NoUTF8      string  `protowire:"8,string,noutf8"`
+		DefaultKey  string  `protowire:"9,string,json=nodef=1,def=a,def=b"`
+		JSONNameKey string  `protowire:"10,string,name=nick_name,json_name=nick"`
+	}
+	rt := reflect.TypeOf(namedTagTest{})
+
+	tests := []struct {
+		name    string
+		field   string
+		wantFn  FieldNumber
+		want    protoFieldMetadata
+		wantDef interface{}
+		wantErr bool
+	}{
+		{
+			name:   "key=value形式のタグを読み取れる",
+			field:  "UserID",
+			wantFn: 3,
+			want: protoFieldMetadata{
+				wt:         WireLengthDelimited,
+				pt:         protoSint64,
+				fts:        fieldTypes{fieldPacked, fieldRepeated},
+				name:       "user_id",
+				jsonName:   "userId",
+				deprecated: true,
+			},
+		},
+		{
+			name:   "位置による指定とkey=value形式を組み合わせられる",
+			field:  "JSONName",
+			wantFn: 4,
+			want: protoFieldMetadata{
+				wt:       WireLengthDelimited,
+				pt:       protoString,
+				fts:      fieldTypes{fieldOptional},
+				name:     "display_name",
+				jsonName: "displayName2",
+			},
+		},
+		{
+			name:   "defはカンマを含めてタグの最後まで読み取る",
+			field:  "Default",
+			wantFn: 5,
+			want: protoFieldMetadata{
+				wt:   WireLengthDelimited,
+				pt:   protoString,
+				fts:  fieldTypes{fieldOptional},
+				name: "Default",
+			},
+			wantDef: "hello, world",
+		},
+		{
+			name:   "defはdef=で始まる要素から読み取り、値に含まれるdef=もそのまま読み取る",
+			field:  "DefaultKey",
+			wantFn: 9,
+			want: protoFieldMetadata{
+				wt:       WireLengthDelimited,
+				pt:       protoString,
+				fts:      fieldTypes{fieldOptional},
+				name:     "DefaultKey",
+				jsonName: "nodef=1",
+			},
+			wantDef: "a,def=b",
+		},
+		{
+			name:   "json_nameでJSONにマッピングする場合の名前を指定できる",
+			field:  "JSONNameKey",
+			wantFn: 10,
+			want: protoFieldMetadata{
+				wt:       WireLengthDelimited,
+				pt:       protoString,
+				fts:      fieldTypes{fieldOptional},
+				name:     "nick_name",
+				jsonName: "nick",
+			},
+		},
+		{
+			name:   "nameを省略するとGoのフィールド名になる",
+			field:  "NoName",
+			wantFn: 6,
+			want: protoFieldMetadata{
+				wt:   WireVarint,
+				pt:   protoInt32,
+				fts:  fieldTypes{fieldOptional},
+				name: "NoName",
+			},
+		},
+		{
+			name:   "noutf8を指定するとUTF-8を検証しない",
+			field:  "NoUTF8",
+			wantFn: 8,
+			want: protoFieldMetadata{
+				wt:     WireLengthDelimited,
+				pt:     protoString,
+				fts:    fieldTypes{fieldOptional},
+				name:   "NoUTF8",
+				noUTF8: true,
+			},
+		},
+		{
+			name:    "不明なkeyはエラー",
+			field:   "UnknownKey",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _ := rt.FieldByName(tt.field)
+			fn, got, err := newProtoFieldMetadata(f, reflect.Value{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newProtoFieldMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if fn != tt.wantFn {
+				t.Errorf("newProtoFieldMetadata() fn = %d, want %d", fn, tt.wantFn)
+			}
+			if got.def.IsValid() != (tt.wantDef != nil) || (got.def.IsValid() && got.def.Interface() != tt.wantDef) {
+				t.Errorf("newProtoFieldMetadata() def = %v, want %v", got.def, tt.wantDef)
+			}
+			got.def = reflect.Value{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newProtoFieldMetadata() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_protoFieldMetadata_label(t *testing.T) {
+	tests := []struct {
+		name string
+		fm   protoFieldMetadata
+		want string
+	}{
+		{
+			name: "nameだけの場合はnameを返す",
+			fm:   protoFieldMetadata{name: "Age"},
+			want: "Age",
+		},
+		{
+			name: "JSONの名前とdeprecatedを併記する",
+			fm:   protoFieldMetadata{name: "user_id", jsonName: "userId", deprecated: true},
+			want: "user_id (json: userId, deprecated)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fm.label(); got != tt.want {
+				t.Errorf("label() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// デコードのエラーメッセージでフィールドを示すのに使われる
+	type labeled struct {
+		UserID int64 `protowire:"num=3,type=sint64,name=user_id,json_name=uid,deprecated"`
+	}
+	err := Unmarshal([]byte{0x1a, 0x00}, &labeled{})
+	if err == nil || !strings.Contains(err.Error(), "user_id (json: uid, deprecated)") {
+		t.Errorf("Unmarshal() error = %v, want error with field label", err)
+	}
+}
@@ -0,0 +1,13 @@
+package protowire
+
+// RawMessage は読み取らずにバイト列のまま受け取った埋め込みメッセージです
+// proto typeに raw を指定した []byte や RawMessage のフィールドには、埋め込みメッセージのバイト列がそのままSetされます
+// 内側のスキーマを定義せずに、外側のフィールドだけを見てメッセージを中継する場合などに利用します
+//
+//	type Envelope struct {
+//		Route   string               `protowire:"1,2,string,optional"`
+//		Payload protowire.RawMessage `protowire:"2,2,raw,optional"`
+//	}
+//
+// このパッケージはエンコードを提供していないので、書き戻す場合は受け取ったバイト列をそのまま埋め込みメッセージの値として利用します
+type RawMessage []byte
@@ -0,0 +1,108 @@
+package protowire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+)
+
+type testRaw struct {
+	EmbedVarint          RawMessage   `protowire:"1,2,raw,optional"`
+	EmbedLengthDelimited []byte       `protowire:"2,2,raw,optional"`
+	Embed64Bit           []RawMessage `protowire:"3"`
+}
+
+func TestUnmarshal_raw(t *testing.T) {
+	varint, _ := proto.Marshal(&testdata.TestVarint{Int32: 12345, Boolean: true})
+	lengthDelimited, _ := proto.Marshal(&testdata.TestLengthDelimited{Str: "これはてすとだよ"})
+	fixed64, _ := proto.Marshal(&testdata.Test64Bit{Fixed64: 67890})
+	b, _ := proto.Marshal(&testdata.TestEmbed{
+		EmbedVarint:          &testdata.TestVarint{Int32: 12345, Boolean: true},
+		EmbedLengthDelimited: &testdata.TestLengthDelimited{Str: "これはてすとだよ"},
+		Embed64Bit:           &testdata.Test64Bit{Fixed64: 67890},
+	})
+
+	got := &testRaw{}
+	if err := Unmarshal(b, got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want := &testRaw{
+		EmbedVarint:          varint,
+		EmbedLengthDelimited: lengthDelimited,
+		Embed64Bit:           []RawMessage{fixed64},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unmarshal() got = %+v, want %+v", got, want)
+	}
+
+	// 受け取ったバイト列は埋め込みメッセージとしてそのまま読み取れる
+	child := &testLazyChild{}
+	if err := Unmarshal(got.EmbedVarint, child); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(child, &testLazyChild{Int32: 12345, Boolean: true}) {
+		t.Errorf("Unmarshal() got = %+v", child)
+	}
+
+	// 入力のバイト列を再利用しても影響しない
+	for i := range b {
+		b[i] = 0
+	}
+	if !bytes.Equal(got.EmbedVarint, varint) {
+		t.Errorf("Unmarshal() RawMessage refers input bytes")
+	}
+}
+
+func TestUnmarshal_rawSplit(t *testing.T) {
+	// 埋め込みメッセージ {Int32: 1} と {Int64: 2} が分かれて現れるバイナリ
+	b := []byte{0x0a, 0x02, 0x08, 0x01, 0x0a, 0x02, 0x10, 0x02}
+	want := RawMessage{0x08, 0x01, 0x10, 0x02}
+
+	tests := []struct {
+		name string
+		opts UnmarshalOptions
+	}{
+		{name: "複数回に分かれて現れたrawの埋め込みメッセージは連結する"},
+		{name: "Aliasが指定されていても連結し、入力のバイト列は書き換えない", opts: UnmarshalOptions{Alias: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]byte{}, b...)
+			got := &testRaw{}
+			if err := tt.opts.Unmarshal(in, got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !bytes.Equal(got.EmbedVarint, want) {
+				t.Errorf("Unmarshal() got = %x, want %x", got.EmbedVarint, want)
+			}
+			if !bytes.Equal(in, b) {
+				t.Errorf("Unmarshal() modified input = %x, want %x", in, b)
+			}
+		})
+	}
+
+	t.Run("Mergeでもrawの埋め込みメッセージは連結する", func(t *testing.T) {
+		dst := &testRaw{EmbedVarint: RawMessage{0x08, 0x01}}
+		if err := Merge(dst, &testRaw{EmbedVarint: RawMessage{0x10, 0x02}}); err != nil {
+			t.Fatalf("Merge() error = %v", err)
+		}
+		if !bytes.Equal(dst.EmbedVarint, want) {
+			t.Errorf("Merge() got = %x, want %x", dst.EmbedVarint, want)
+		}
+	})
+}
+
+func TestValidateType_raw(t *testing.T) {
+	if err := ValidateType(reflect.TypeOf(testRaw{})); err != nil {
+		t.Errorf("ValidateType() error = %v", err)
+	}
+	type rawString struct {
+		Raw string `protowire:"1,2,raw,optional"`
+	}
+	if err := ValidateType(reflect.TypeOf(rawString{})); err == nil {
+		t.Errorf("ValidateType() error = nil, want proto type mismatch")
+	}
+}
@@ -0,0 +1,269 @@
+package protowire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// DefaultMaxValueSize は Decoder.MaxValueSize が指定されていない場合に、1つのlength delimitedな値としてバッファできる最大のバイト数です
+const DefaultMaxValueSize = 64 << 20
+
+// ErrValueTooLarge は Decoder がバッファしようとしたlength delimitedな値が MaxValueSize を超えていたことを表します
+var ErrValueTooLarge = errors.New("length-delimited value exceeds max value size")
+
+// Decoder は io.Reader からwireバイナリを少しずつ読み取って、メッセージ全体をメモリに載せずにstructにbindします
+//
+// タグとvarint, 64-bit, 32-bitの値はバッファせずに読み取り、packedなrepeatedのスカラー値も要素ごとに読み取ります
+// 埋め込みメッセージやstring, bytesなどのlength delimitedな値は、値ごとにバッファしてから読み取ります
+type Decoder struct {
+	// Options は読み取りの設定で、 UnmarshalOptions.Unmarshal と同じように扱います
+	Options UnmarshalOptions
+	// MaxValueSize は1つのlength delimitedな値としてバッファできる最大のバイト数です。0の場合は DefaultMaxValueSize です
+	// これを超える値が現れると ErrValueTooLarge を返します
+	MaxValueSize int
+
+	r *bufio.Reader
+	// offset はこれまでに r から読み取ったバイト数です
+	offset int
+}
+
+// NewDecoder は r から読み取る Decoder を返します
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode は r を終端まで読み取って1つのメッセージとして v にbindします
+func (dec *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if !dec.Options.Merge && rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	}
+	d := newDecodeState(dec.Options)
+	ms, err := d.message(v)
+	if err != nil {
+		return err
+	}
+	pm, seen := ms.pm, ms.seen
+	var lastFn FieldNumber
+	for {
+		start := dec.offset
+		tag, err := dec.readVarint(nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tag: %w", err)
+		}
+		fn, wt, _, err := ConsumeTag(tag)
+		if err != nil {
+			return fmt.Errorf("failed to read tag: %w", err)
+		}
+
+		if d.maskOut(pm, fn) {
+			if err := dec.skip(wt); err != nil {
+				return fmt.Errorf("failed to skip masked field %d: %w", fn, err)
+			}
+			continue
+		}
+		// Strict で検証する場合は値全体が必要なので、常にバッファしてから読み取ります
+		if !d.opts.Strict {
+			fm, isField := pm.fields[fn]
+			if isField && wt == WireLengthDelimited && fm.isRepeatedScalar() {
+				if err := fm.embed.alloc(); err != nil {
+					return err
+				}
+				leave := d.enterMask(fm.name)
+				err := dec.decodePacked(d, fm)
+				leave()
+				if err != nil {
+					return fmt.Errorf("failed to read field %s value: %w", fm.label(), err)
+				}
+				seen[fn] = true
+				continue
+			}
+			_, isOneOfField := pm.oneOfFields[fn]
+			if !isField && !isOneOfField && !(pm.extensions != nil && pm.extensions.inRange(fn)) {
+				if err := dec.skip(wt); err != nil {
+					return fmt.Errorf("failed to skip unknown field %d: %w", fn, err)
+				}
+				continue
+			}
+		}
+
+		buf, err := dec.readValue(tag, wt)
+		if err != nil {
+			return fmt.Errorf("failed to read field %d value: %w", fn, err)
+		}
+		// buf はタグと値だけを持つバイト列なので、capから r の先頭からの位置を求められるようにします
+		d.capBase = start + cap(buf)
+		tag = buf[:len(tag)]
+		if d.opts.Strict {
+			d.checkTag(tag, fn, lastFn)
+		}
+		lastFn = fn
+		if _, err := d.unmarshalField(pm, rv.Type().Elem(), seen, fn, wt, tag, buf[len(tag):]); err != nil {
+			return err
+		}
+	}
+	d.finish(rv)
+	return d.result()
+}
+
+// decodePacked はpackedなrepeatedのスカラー値を、全体をバッファせずに要素ごとに読み取って fm にbindします
+func (dec *Decoder) decodePacked(d *decodeState, fm protoFieldMetadata) error {
+	if !fm.rv.CanSet() {
+		return fmt.Errorf("cant't set field, field type: %s", fm.rv.Type().String())
+	}
+	b, err := dec.readVarint(nil)
+	if err != nil {
+		return fmt.Errorf("failed to read varint field: %w", unexpectedEOF(err))
+	}
+	byteLen, _, err := ConsumeVarint(b)
+	if err != nil {
+		return fmt.Errorf("failed to read varint field: %w", err)
+	}
+	ptwt, err := fm.pt.toWireType()
+	if err != nil {
+		return fmt.Errorf("failed to convert proto type to wire type: %w", err)
+	}
+	for byteLen > 0 {
+		var elem []byte
+		switch ptwt {
+		case WireVarint:
+			elem, err = dec.readVarint(nil)
+		case WireFixed64:
+			elem, err = dec.readFull(nil, 8)
+		case WireFixed32:
+			elem, err = dec.readFull(nil, 4)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read packed field: %w", unexpectedEOF(err))
+		}
+		if uint64(len(elem)) > byteLen {
+			return errors.New("packed element overruns length-delimited field")
+		}
+		byteLen -= uint64(len(elem))
+		if _, err := d.bindBytes(fm, ptwt, elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readValue はwire typeに従ってフィールドの値を読み取り、 tag に続けた新しいバイト列を返します
+// 返すバイト列はlenとcapが等しくなるように確保します
+func (dec *Decoder) readValue(tag []byte, wt WireType) ([]byte, error) {
+	b := append(make([]byte, 0, len(tag)+binary.MaxVarintLen64), tag...)
+	var err error
+	switch wt {
+	case WireVarint:
+		b, err = dec.readVarint(b)
+	case WireFixed64:
+		b, err = dec.readFull(b, 8)
+	case WireFixed32:
+		b, err = dec.readFull(b, 4)
+	case WireLengthDelimited:
+		if b, err = dec.readVarint(b); err != nil {
+			break
+		}
+		var byteLen uint64
+		if byteLen, _, err = ConsumeVarint(b[len(tag):]); err != nil {
+			return nil, fmt.Errorf("failed to read varint field: %w", err)
+		}
+		if byteLen > uint64(dec.maxValueSize()) {
+			return nil, fmt.Errorf("%w: %d bytes", ErrValueTooLarge, byteLen)
+		}
+		b, err = dec.readFull(b, int(byteLen))
+	default:
+		return nil, fmt.Errorf("unsupported type: %d", wt)
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b[:len(b):len(b)], nil
+}
+
+// skip はwire typeに従ってフィールドの値をバッファせずに読み飛ばします
+func (dec *Decoder) skip(wt WireType) error {
+	var n uint64
+	switch wt {
+	case WireVarint:
+		_, err := dec.readVarint(nil)
+		return unexpectedEOF(err)
+	case WireFixed64:
+		n = 8
+	case WireFixed32:
+		n = 4
+	case WireLengthDelimited:
+		b, err := dec.readVarint(nil)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if n, _, err = ConsumeVarint(b); err != nil {
+			return fmt.Errorf("failed to read varint field: %w", err)
+		}
+		// io.CopyN はint64で長さを受け取るので、それを超える長さは読み飛ばせません
+		if n > math.MaxInt64 {
+			return fmt.Errorf("length-delimited value is too large to skip: %d bytes", n)
+		}
+	default:
+		return fmt.Errorf("unsupported type: %d", wt)
+	}
+	m, err := io.CopyN(io.Discard, dec.r, int64(n))
+	dec.offset += int(m)
+	return unexpectedEOF(err)
+}
+
+// readVarint はvarintを1バイトずつ読み取って b に追加します
+// 1バイトも読み取れずに r が終端に達した場合は io.EOF を返します
+func (dec *Decoder) readVarint(b []byte) ([]byte, error) {
+	for i := 0; ; i++ {
+		if i == binary.MaxVarintLen64 {
+			return nil, errors.New("the value of varint is up to 64 bits")
+		}
+		c, err := dec.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && i > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		dec.offset++
+		b = append(b, c)
+		if c < 0x80 {
+			return b, nil
+		}
+	}
+}
+
+// readFull は r から n バイト読み取って b に追加した新しいバイト列を返します
+func (dec *Decoder) readFull(b []byte, n int) ([]byte, error) {
+	buf := make([]byte, len(b)+n)
+	copy(buf, b)
+	m, err := io.ReadFull(dec.r, buf[len(b):])
+	dec.offset += m
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf, nil
+}
+
+func (dec *Decoder) maxValueSize() int {
+	if dec.MaxValueSize > 0 {
+		return dec.MaxValueSize
+	}
+	return DefaultMaxValueSize
+}
+
+// unexpectedEOF は値の途中で r が終端に達したことを表すように io.EOF を io.ErrUnexpectedEOF に置き換えます
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package protowire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/convto/protowire/testdata"
+	"github.com/golang/protobuf/proto"
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
+type testStreamChild struct {
+	Str   string `protowire:"1,2,string,optional"`
+	Bytes []byte `protowire:"2,2,bytes,optional"`
+}
+
+type testStream struct {
+	Int64               []int64            `protowire:"1,2,int64,packed,repeated"`
+	Fixed64             []uint64           `protowire:"2,2,fixed64,packed,repeated"`
+	Fixed32             []uint32           `protowire:"3,2,fixed32,packed,repeated"`
+	Str                 []string           `protowire:"4,2,string,repeated"`
+	Bytes               [][]byte           `protowire:"5,2,bytes,repeated"`
+	TestLengthDelimited []*testStreamChild `protowire:"6,2,embed,repeated"`
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	repeated, _ := proto.Marshal(&testdata.TestRepeated{
+		Int64:   []int64{1, -2, 1 << 40},
+		Fixed64: []uint64{3, 4},
+		Fixed32: []uint32{5},
+		Str:     []string{"a", "これはてすとだよ"},
+		Bytes:   [][]byte{{0xFF, 0xEE}},
+		TestLengthDelimited: []*testdata.TestLengthDelimited{
+			{Str: "child", Bytes: []byte{0x01}},
+		},
+	})
+	want := &testStream{
+		Int64:   []int64{1, -2, 1 << 40},
+		Fixed64: []uint64{3, 4},
+		Fixed32: []uint32{5},
+		Str:     []string{"a", "これはてすとだよ"},
+		Bytes:   [][]byte{{0xFF, 0xEE}},
+		TestLengthDelimited: []*testStreamChild{
+			{Str: "child", Bytes: []byte{0x01}},
+		},
+	}
+	// 長いpackedなフィールドは MaxValueSize を超えていても要素ごとに読み取れる
+	var largePacked []byte
+	var largeWant []int64
+	for i := 0; i < 1000; i++ {
+		largePacked = wire.AppendVarint(largePacked, uint64(i))
+		largeWant = append(largeWant, int64(i))
+	}
+	unknown := wire.AppendBytes(wire.AppendTag(nil, 100, wire.BytesType), make([]byte, 1000))
+
+	tests := []struct {
+		name         string
+		b            []byte
+		maxValueSize int
+		want         *testStream
+		wantErr      error
+	}{
+		{
+			name: "Unmarshalと同じく読み取れる",
+			b:    repeated,
+			want: want,
+		},
+		{
+			name:         "packedなフィールドはバッファせずに読み取る",
+			b:            wire.AppendBytes(wire.AppendTag(nil, 1, wire.BytesType), largePacked),
+			maxValueSize: 16,
+			want:         &testStream{Int64: largeWant},
+		},
+		{
+			name:         "未知のフィールドはバッファせずに読み飛ばす",
+			b:            append(append([]byte{}, unknown...), repeated...),
+			maxValueSize: 64,
+			want:         want,
+		},
+		{
+			name:         "MaxValueSizeを超えるlength delimitedな値はエラー",
+			b:            wire.AppendString(wire.AppendTag(nil, 4, wire.BytesType), "this is too large"),
+			maxValueSize: 16,
+			wantErr:      ErrValueTooLarge,
+		},
+		{
+			name:    "値の途中で終端に達するとエラー",
+			b:       repeated[:len(repeated)-1],
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "packedなフィールドの途中で終端に達するとエラー",
+			b:       wire.AppendBytes(wire.AppendTag(nil, 1, wire.BytesType), largePacked)[:100],
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 1バイトずつ読み取るreaderでも読み取れる
+			dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(tt.b)))
+			dec.MaxValueSize = tt.maxValueSize
+			got := &testStream{}
+			err := dec.Decode(got)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder_Decode_skipTooLarge(t *testing.T) {
+	// 未知のフィールド 15 の長さが 1<<63 バイト
+	b := wire.AppendVarint(wire.AppendTag(nil, 15, wire.BytesType), 1<<63)
+	if err := NewDecoder(bytes.NewReader(b)).Decode(&testStream{}); err == nil {
+		t.Fatal("Decode() error = nil, want error")
+	}
+}
+
+func TestDecoder_Decode_options(t *testing.T) {
+	t.Run("Strictの違反は入力の先頭からの位置で報告される", func(t *testing.T) {
+		dec := NewDecoder(bytes.NewReader([]byte{0x08, 0x01, 0x22, 0x03, 0x08, 0x81, 0x00}))
+		dec.Options.Strict = true
+		err := dec.Decode(&testStrict{})
+		var serr *StrictError
+		if !errors.As(err, &serr) {
+			t.Fatalf("Decode() error = %v, want *StrictError", err)
+		}
+		want := []Violation{{Offset: 5, Path: "Child.Uint32", Reason: "overlong varint"}}
+		if !reflect.DeepEqual(serr.Violations, want) {
+			t.Errorf("Decode() violations = %+v, want %+v", serr.Violations, want)
+		}
+	})
+	t.Run("requiredなフィールドが含まれていなければエラー", func(t *testing.T) {
+		type requiredMessage struct {
+			Int32 int32 `protowire:"1,0,int32,required"`
+		}
+		err := NewDecoder(bytes.NewReader(nil)).Decode(&requiredMessage{})
+		var rerr *RequiredNotSetError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("Decode() error = %v, want *RequiredNotSetError", err)
+		}
+	})
+}
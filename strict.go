@@ -0,0 +1,116 @@
+package protowire
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Violation は UnmarshalOptions.Strict で見つかった正規でないエンコーディングを表します
+// Offset は Unmarshal に渡したバイト列の先頭から、問題のあるタグや値までのバイト数です
+type Violation struct {
+	Offset int
+	Path   string
+	Reason string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return fmt.Sprintf("offset %d: %s", v.Offset, v.Reason)
+	}
+	return fmt.Sprintf("offset %d: %s: %s", v.Offset, v.Path, v.Reason)
+}
+
+// StrictError は UnmarshalOptions.Strict で見つかった正規でないエンコーディングをすべて保持します
+type StrictError struct {
+	Violations []Violation
+}
+
+func (e *StrictError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return fmt.Sprintf("non-canonical encoding: %s", strings.Join(msgs, "; "))
+}
+
+// addViolation は b の先頭の位置で見つかった違反を記録します
+// Unmarshal の中で扱うバイト列はすべて渡されたバイト列の部分スライスなので、capの差から先頭からの位置を求めます
+func (d *decodeState) addViolation(b []byte, path, reason string) {
+	d.violations = append(d.violations, Violation{
+		Offset: d.capBase - cap(b),
+		Path:   path,
+		Reason: reason,
+	})
+}
+
+// checkTag はタグが正規のエンコーディングで、field numberが昇順に並んでいるかを検証します
+func (d *decodeState) checkTag(tag []byte, fn, lastFn FieldNumber) {
+	if !isCanonicalVarint(tag) {
+		d.addViolation(tag, d.fieldPath(fmt.Sprint(fn)), "overlong varint in tag")
+	}
+	if fn < lastFn {
+		d.addViolation(tag, d.fieldPath(fmt.Sprint(fn)), fmt.Sprintf("field number %d appears after %d", fn, lastFn))
+	}
+}
+
+// checkField はフィールドの値が正規のエンコーディングかを検証します
+// val はタグを除いたフィールドの値のバイト列で、 duplicated はすでに同じフィールドが現れていたかどうかです
+func (d *decodeState) checkField(fm protoFieldMetadata, wt WireType, tag, val []byte, duplicated bool) {
+	path := d.fieldPath(fm.name)
+	repeated := isRepeatedType(fm.rv.Type())
+	if duplicated && !repeated {
+		d.addViolation(tag, path, "non-repeated field appears more than once")
+	}
+	if fm.fts.Has(fieldPacked) && wt != WireLengthDelimited {
+		d.addViolation(tag, path, "packed field is encoded as unpacked")
+	}
+
+	switch wt {
+	case WireVarint:
+		d.checkVarint(fm.pt, val, path)
+	case WireLengthDelimited:
+		byteLen, n, err := ConsumeVarint(val)
+		if err != nil {
+			return
+		}
+		if !isCanonicalVarint(val[:n]) {
+			d.addViolation(val, path, "overlong varint in length")
+		}
+		ptwt, err := fm.pt.toWireType()
+		if err != nil || ptwt != WireVarint {
+			return
+		}
+		// packedなvarintはそれぞれの要素を検証します
+		for packed := val[n : n+int(byteLen)]; len(packed) > 0; {
+			_, m, err := ConsumeVarint(packed)
+			if err != nil {
+				return
+			}
+			d.checkVarint(fm.pt, packed, path)
+			packed = packed[m:]
+		}
+	}
+}
+
+// checkVarint はvarintの値が最短のエンコーディングで、proto typeの範囲に収まっているかを検証します
+func (d *decodeState) checkVarint(pt protoType, b []byte, path string) {
+	v, n, err := ConsumeVarint(b)
+	if err != nil {
+		return
+	}
+	if !isCanonicalVarint(b[:n]) {
+		d.addViolation(b, path, "overlong varint")
+	}
+	if !varintInRange(pt, v) {
+		d.addViolation(b, path, fmt.Sprintf("%s value %d overflows 32 bits", pt, v))
+	}
+	if pt == protoBool && v > 1 {
+		d.addViolation(b, path, fmt.Sprintf("bool value must be 0 or 1, but %d", v))
+	}
+}
+
+// isCanonicalVarint はvarintが最短のバイト数でエンコードされているかを返します
+// 2バイト以上のvarintで最後のバイトが0の場合は、上位に不要な0が続いているので正規のエンコーディングではありません
+func isCanonicalVarint(b []byte) bool {
+	return len(b) == 1 || b[len(b)-1] != 0
+}
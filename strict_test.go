@@ -0,0 +1,126 @@
+package protowire
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testStrictChild struct {
+	Uint32 uint32 `protowire:"1,0,uint32,optional"`
+}
+
+type testStrict struct {
+	Int32   int32            `protowire:"1,0,int32,optional"`
+	Boolean bool             `protowire:"2,0,bool,optional"`
+	Packed  []int32          `protowire:"3,2,int32,packed,repeated"`
+	Child   *testStrictChild `protowire:"4,2,embed,optional"`
+}
+
+func TestUnmarshalOptions_Unmarshal_strict(t *testing.T) {
+	tests := []struct {
+		name           string
+		b              []byte
+		wantViolations []Violation
+	}{
+		{
+			name: "正規のエンコーディングは違反にならない",
+			b:    []byte{0x08, 0x01, 0x10, 0x01, 0x1a, 0x02, 0x01, 0x02, 0x22, 0x02, 0x08, 0x01},
+		},
+		{
+			name: "最短でないタグは違反",
+			b:    []byte{0x88, 0x00, 0x01},
+			wantViolations: []Violation{
+				{Offset: 0, Path: "1", Reason: "overlong varint in tag"},
+			},
+		},
+		{
+			name: "最短でないvarintの値は違反",
+			b:    []byte{0x08, 0x81, 0x00},
+			wantViolations: []Violation{
+				{Offset: 1, Path: "Int32", Reason: "overlong varint"},
+			},
+		},
+		{
+			name: "field numberが昇順でなければ違反",
+			b:    []byte{0x10, 0x01, 0x08, 0x01},
+			wantViolations: []Violation{
+				{Offset: 2, Path: "1", Reason: "field number 1 appears after 2"},
+			},
+		},
+		{
+			name: "repeatedでないフィールドが複数回現れると違反",
+			b:    []byte{0x08, 0x01, 0x08, 0x02},
+			wantViolations: []Violation{
+				{Offset: 2, Path: "Int32", Reason: "non-repeated field appears more than once"},
+			},
+		},
+		{
+			name: "32bitに収まらないint32の値は違反",
+			b:    []byte{0x08, 0x80, 0x80, 0x80, 0x80, 0x10},
+			wantViolations: []Violation{
+				{Offset: 1, Path: "Int32", Reason: "int32 value 4294967296 overflows 32 bits"},
+			},
+		},
+		{
+			name: "0か1でないboolの値は違反",
+			b:    []byte{0x10, 0x02},
+			wantViolations: []Violation{
+				{Offset: 1, Path: "Boolean", Reason: "bool value must be 0 or 1, but 2"},
+			},
+		},
+		{
+			name: "packedとして宣言されたフィールドのunpackedなエンコーディングは違反",
+			b:    []byte{0x18, 0x01, 0x18, 0x02},
+			wantViolations: []Violation{
+				{Offset: 0, Path: "Packed", Reason: "packed field is encoded as unpacked"},
+				{Offset: 2, Path: "Packed", Reason: "packed field is encoded as unpacked"},
+			},
+		},
+		{
+			name: "packedの要素も検証する",
+			b:    []byte{0x1a, 0x03, 0x01, 0x82, 0x00},
+			wantViolations: []Violation{
+				{Offset: 3, Path: "Packed", Reason: "overlong varint"},
+			},
+		},
+		{
+			name: "埋め込みメッセージの違反はパスと先頭からの位置で報告される",
+			b:    []byte{0x08, 0x01, 0x22, 0x03, 0x08, 0x81, 0x00},
+			wantViolations: []Violation{
+				{Offset: 5, Path: "Child.Uint32", Reason: "overlong varint"},
+			},
+		},
+		{
+			name: "複数の違反をすべて報告する",
+			b:    []byte{0x08, 0x81, 0x00, 0x10, 0x02},
+			wantViolations: []Violation{
+				{Offset: 1, Path: "Int32", Reason: "overlong varint"},
+				{Offset: 4, Path: "Boolean", Reason: "bool value must be 0 or 1, but 2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Strictを指定しなければ違反があっても読み取れる
+			if err := Unmarshal(tt.b, &testStrict{}); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			err := UnmarshalOptions{Strict: true}.Unmarshal(tt.b, &testStrict{})
+			if tt.wantViolations == nil {
+				if err != nil {
+					t.Fatalf("Unmarshal() error = %v", err)
+				}
+				return
+			}
+			var serr *StrictError
+			if !errors.As(err, &serr) {
+				t.Fatalf("Unmarshal() error = %v, want *StrictError", err)
+			}
+			if !reflect.DeepEqual(serr.Violations, tt.wantViolations) {
+				t.Errorf("Unmarshal() violations = %+v, want %+v", serr.Violations, tt.wantViolations)
+			}
+		})
+	}
+}
@@ -2,29 +2,31 @@ package protowire
 
 import (
 	"fmt"
+	"reflect"
 )
 
-// wireType はwireバイナリの各fieldのtype
-type wireType uint8
+// WireType はwireバイナリの各fieldのtype
+type WireType uint8
 
 const (
-	wireVarint          wireType = 0
-	wireFixed64         wireType = 1
-	wireLengthDelimited wireType = 2
-	// wireStartGroup unsupported wire type
-	// wireEndGroup unsupported wire type
-	wireFixed32 wireType = 5
+	WireVarint          WireType = 0
+	WireFixed64         WireType = 1
+	WireLengthDelimited WireType = 2
+	// WireStartGroup unsupported wire type
+	// WireEndGroup unsupported wire type
+	WireFixed32 WireType = 5
 )
 
-func (wt wireType) Packable() bool {
-	if wt == wireVarint || wt == wireFixed32 || wt == wireFixed64 {
+// Packable はrepeatedなフィールドをpackedとしてエンコードできるwire typeかを返します
+func (wt WireType) Packable() bool {
+	if wt == WireVarint || wt == WireFixed32 || wt == WireFixed64 {
 		return true
 	}
 	return false
 }
 
-// fieldNumber はwireバイナリのフィールド番号
-type fieldNumber uint32
+// FieldNumber はwireバイナリのフィールド番号
+type FieldNumber uint32
 
 // protoType はwireバイナリをパースするときにどの型としてパースするのかの情報
 type protoType string
@@ -47,12 +49,19 @@ const (
 	protoString protoType = "string"
 	protoBytes  protoType = "bytes"
 	protoEmbed  protoType = "embed"
+	// protoRaw は埋め込みメッセージを読み取らずにバイト列のまま受け取るためのproto typeです
+	protoRaw protoType = "raw"
 	// 32bit proto type
 	protoFixed32  protoType = "fixed32"
 	protoSfixed32 protoType = "sfixed32"
 	protoFloat    protoType = "float"
 )
 
+func (pt protoType) isValid() bool {
+	_, err := pt.toWireType()
+	return err == nil
+}
+
 func (pt protoType) isZigzag() bool {
 	if pt == protoSint32 || pt == protoSint64 {
 		return true
@@ -60,27 +69,113 @@ func (pt protoType) isZigzag() bool {
 	return false
 }
 
-func (pt protoType) toWireType() (wireType, error) {
+func (pt protoType) toWireType() (WireType, error) {
 	switch pt {
 	case protoInt32, protoInt64, protoUint32, protoUint64, protoSint32, protoSint64, protoBool, protoEnum:
-		return wireVarint, nil
+		return WireVarint, nil
 	case protoFixed64, protoSfixed64, protoDouble:
-		return wireFixed64, nil
-	case protoString, protoBytes, protoEmbed:
-		return wireLengthDelimited, nil
+		return WireFixed64, nil
+	case protoString, protoBytes, protoEmbed, protoRaw:
+		return WireLengthDelimited, nil
 	case protoFixed32, protoSfixed32, protoFloat:
-		return wireFixed32, nil
+		return WireFixed32, nil
 	default:
 		return 0, fmt.Errorf("unknown proto type: %s", pt)
 	}
 }
 
+// matchGoType はproto typeの値を与えられたGoの型にbindできるかを判定します
+// repeatedなフィールドの場合はsliceの要素の型を渡します
+func (pt protoType) matchGoType(rt reflect.Type) bool {
+	switch pt {
+	case protoInt32, protoSint32, protoSfixed32, protoEnum:
+		return rt.Kind() == reflect.Int32
+	case protoInt64, protoSint64, protoSfixed64:
+		return rt.Kind() == reflect.Int64
+	case protoUint32, protoFixed32:
+		return rt.Kind() == reflect.Uint32
+	case protoUint64, protoFixed64:
+		return rt.Kind() == reflect.Uint64
+	case protoBool:
+		return rt.Kind() == reflect.Bool
+	case protoFloat:
+		return rt.Kind() == reflect.Float32
+	case protoDouble:
+		return rt.Kind() == reflect.Float64
+	case protoString:
+		return rt.Kind() == reflect.String
+	case protoBytes:
+		return rt == reflect.TypeOf([]byte(nil))
+	case protoRaw:
+		return rt == reflect.TypeOf([]byte(nil)) || rt == reflect.TypeOf(RawMessage(nil))
+	case protoEmbed:
+		return rt.Kind() == reflect.Ptr && rt.Elem().Kind() == reflect.Struct
+	default:
+		return false
+	}
+}
+
+// inferProtoType はタグでproto typeが省略された場合に、Goの型からproto typeを推論します
+// sliceの場合は要素の型から推論しますが、[]byteはbytesとして扱います
+// sint32, fixed64などエンコード方式が複数ありうる型は、protobufの標準的な型として推論します
+func inferProtoType(rt reflect.Type) (protoType, error) {
+	if isRepeatedType(rt) {
+		rt = rt.Elem()
+	}
+	switch {
+	case rt == reflect.TypeOf(RawMessage(nil)):
+		return protoRaw, nil
+	case rt == reflect.TypeOf([]byte(nil)):
+		return protoBytes, nil
+	case rt.Kind() == reflect.Ptr && rt.Elem().Kind() == reflect.Struct:
+		return protoEmbed, nil
+	}
+	switch rt.Kind() {
+	case reflect.Int32:
+		return protoInt32, nil
+	case reflect.Int64:
+		return protoInt64, nil
+	case reflect.Uint32:
+		return protoUint32, nil
+	case reflect.Uint64:
+		return protoUint64, nil
+	case reflect.Bool:
+		return protoBool, nil
+	case reflect.Float32:
+		return protoFloat, nil
+	case reflect.Float64:
+		return protoDouble, nil
+	case reflect.String:
+		return protoString, nil
+	default:
+		return "", fmt.Errorf("can not infer proto type from %s", rt.String())
+	}
+}
+
+// isRepeatedType はrepeatedなフィールドとして扱うGoの型かを返します
+// []byte や RawMessage のようなバイト列のsliceは1つの値として扱います
+func isRepeatedType(rt reflect.Type) bool {
+	return rt.Kind() == reflect.Slice && rt.Elem().Kind() != reflect.Uint8
+}
+
+// inferFieldTypes はタグでfield typesが省略された場合に、Goの型からfield typesを推論します
+// []byte以外のsliceはrepeatedとし、packできるproto typeであればproto3と同様にpackedとして扱います
+func inferFieldTypes(rt reflect.Type, pt protoType) fieldTypes {
+	if !isRepeatedType(rt) {
+		return fieldTypes{fieldOptional}
+	}
+	if ptwt, err := pt.toWireType(); err == nil && ptwt.Packable() {
+		return fieldTypes{fieldPacked, fieldRepeated}
+	}
+	return fieldTypes{fieldRepeated}
+}
+
 // fieldType はwireバイナリの各フィールドの形式などについての情報
 type fieldType string
 
 func newFieldType(s string) (fieldType, error) {
 	switch ft := fieldType(s); ft {
-	case fieldOptional, fieldPacked, fieldRepeated, fieldOneOf:
+	case fieldOptional, fieldRequired, fieldPacked, fieldRepeated, fieldOneOf:
 		return ft, nil
 	default:
 		return "", fmt.Errorf("unsupported field type: %s", s)
@@ -89,6 +184,7 @@ func newFieldType(s string) (fieldType, error) {
 
 const (
 	fieldOptional fieldType = "optional"
+	fieldRequired fieldType = "required"
 	fieldPacked   fieldType = "packed"
 	fieldRepeated fieldType = "repeated"
 	fieldOneOf    fieldType = "oneof"
@@ -105,12 +201,26 @@ func (fs fieldTypes) Has(ft fieldType) bool {
 	return false
 }
 
-func (fs fieldTypes) validate() error {
+// validate はfield typeの組み合わせが正しいかを検証します
+// packedはvarint, 64-bit, 32-bitのいずれかのwire typeになるproto typeにしか指定できないので、 pt も合わせて検証します
+func (fs fieldTypes) validate(pt protoType) error {
 	if fs.Has(fieldOneOf) && fs.Has(fieldRepeated) {
 		return fmt.Errorf("if field types has oneof, field type repeated can not set: %s", fs)
 	}
+	if fs.Has(fieldRequired) && (fs.Has(fieldOptional) || fs.Has(fieldRepeated) || fs.Has(fieldOneOf)) {
+		return fmt.Errorf("if field types has required, field types optional, repeated and oneof can not set: %s", fs)
+	}
 	if fs.Has(fieldPacked) && !fs.Has(fieldRepeated) {
 		return fmt.Errorf("if field types has packed, field types must have repeated: %s", fs)
 	}
+	if fs.Has(fieldPacked) {
+		ptwt, err := pt.toWireType()
+		if err != nil {
+			return fmt.Errorf("failed to convert proto type to wire type: %w", err)
+		}
+		if !ptwt.Packable() {
+			return fmt.Errorf("packed can not set to proto type %s: %s", pt, fs)
+		}
+	}
 	return nil
 }
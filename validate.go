@@ -0,0 +1,184 @@
+package protowire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaError は ValidateType で見つかったstruct定義の問題をすべて保持します
+type SchemaError struct {
+	Type   reflect.Type
+	Errors []error
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid schema %s: %s", e.Type.String(), strings.Join(msgs, "; "))
+}
+
+// ValidateType は `protowire` タグが付与されたstructの定義を検証します
+// 実際にバイト列をパースしたときにしか気づけないようなタグの誤りを事前に見つけるためのもので、
+// 埋め込みメッセージやoneofの実装も再帰的に検証し、見つかった問題をまとめて *SchemaError として返します
+func ValidateType(rt reflect.Type) error {
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return errors.New("target type must be a struct")
+	}
+	v := &typeValidator{visited: make(map[reflect.Type]bool)}
+	v.validateMessage(rt)
+	if len(v.errs) > 0 {
+		return &SchemaError{Type: rt, Errors: v.errs}
+	}
+	return nil
+}
+
+// typeValidator は検証中に見つかったエラーと、再帰的なメッセージ定義で無限ループしないように検証済みの型を保持します
+type typeValidator struct {
+	errs    []error
+	visited map[reflect.Type]bool
+}
+
+func (v *typeValidator) addErr(rt reflect.Type, f reflect.StructField, err error) {
+	v.errs = append(v.errs, fmt.Errorf("%s.%s: %w", rt.String(), f.Name, err))
+}
+
+// validateMessage はあるメッセージに対応するstructを検証します
+// 埋め込みstructを平坦化したうえでfield numberが重複していないかも検証します
+func (v *typeValidator) validateMessage(rt reflect.Type) {
+	if v.visited[rt] {
+		return
+	}
+	v.visited[rt] = true
+	v.validateFields(rt, make(map[FieldNumber]string))
+}
+
+func (v *typeValidator) validateFields(rt reflect.Type, seen map[FieldNumber]string) {
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		_, ok, err := oneOfName(f)
+		if err != nil {
+			v.addErr(rt, f, err)
+			continue
+		}
+		if ok {
+			v.validateOneOf(rt, f, seen)
+			continue
+		}
+		if _, ok := f.Tag.Lookup(protoExtensionsTag); ok {
+			if _, err := newExtensionsMetadata(f, reflect.Value{}); err != nil {
+				v.addErr(rt, f, err)
+			}
+			continue
+		}
+		if f.Anonymous {
+			if _, ok := f.Tag.Lookup(protoTag); !ok {
+				et := f.Type
+				if et.Kind() == reflect.Ptr {
+					et = et.Elem()
+				}
+				if et.Kind() != reflect.Struct {
+					v.addErr(rt, f, fmt.Errorf("embedded field must be a struct or a pointer to struct, but %s", f.Type.String()))
+					continue
+				}
+				v.validateFields(et, seen)
+				continue
+			}
+		}
+		fn, fm, err := newProtoFieldMetadata(f, reflect.Value{})
+		if err != nil {
+			v.addErr(rt, f, err)
+			continue
+		}
+		v.checkFieldNumber(rt, f, fn, seen)
+		for _, err := range v.validateField(fm, f.Type) {
+			v.addErr(rt, f, err)
+		}
+	}
+}
+
+// validateOneOf はoneofフィールドのinterfaceを実装するstructをすべて検証します
+func (v *typeValidator) validateOneOf(rt reflect.Type, f reflect.StructField, seen map[FieldNumber]string) {
+	if f.Type.Kind() != reflect.Interface {
+		v.addErr(rt, f, fmt.Errorf("oneof field type must be interface, but %s", f.Type.Kind().String()))
+		return
+	}
+	impls, err := getImplements(f.Type)
+	if err != nil {
+		v.addErr(rt, f, fmt.Errorf("failed to get %s implements: %w", f.Type.String(), err))
+		return
+	}
+	for _, impl := range impls {
+		it := impl.Type().Elem()
+		if it.Kind() != reflect.Struct {
+			v.addErr(rt, f, fmt.Errorf("oneof implement %s must be a struct", it.String()))
+			continue
+		}
+		if it.NumField() != 1 {
+			v.addErr(rt, f, fmt.Errorf("oneof implement %s field size must be 1, but %d", it.String(), it.NumField()))
+			continue
+		}
+		implField := it.Field(0)
+		fn, fm, err := newProtoFieldMetadata(implField, reflect.Value{})
+		if err != nil {
+			v.addErr(it, implField, err)
+			continue
+		}
+		if !fm.fts.Has(fieldOneOf) {
+			v.addErr(it, implField, fmt.Errorf("oneof field type must be fieldOneOf, but %s", fm.fts))
+		}
+		v.checkFieldNumber(it, implField, fn, seen)
+		for _, err := range v.validateField(fm, implField.Type) {
+			v.addErr(it, implField, err)
+		}
+	}
+}
+
+// checkFieldNumber はfield numberが予約済みの範囲になく、同じメッセージ内で重複していないかを検証します
+// 0以下や上限を超えるfield numberはタグを読み取るときにエラーになります
+func (v *typeValidator) checkFieldNumber(rt reflect.Type, f reflect.StructField, fn FieldNumber, seen map[FieldNumber]string) {
+	if fn.IsReserved() {
+		v.addErr(rt, f, fmt.Errorf("field number %d is reserved for the protocol buffers implementation", fn))
+	}
+	if name, ok := seen[fn]; ok {
+		v.addErr(rt, f, fmt.Errorf("duplicate field number %d, already used by %s", fn, name))
+		return
+	}
+	seen[fn] = rt.String() + "." + f.Name
+}
+
+// validateField はfield typesの組み合わせや、タグとGoの型が矛盾していないかを検証します
+// wire typeとproto typeの矛盾はタグを読み取る時点で検出されます
+// embedの場合は埋め込まれるメッセージも再帰的に検証します
+func (v *typeValidator) validateField(fm protoFieldMetadata, rt reflect.Type) []error {
+	var errs []error
+	if err := fm.fts.validate(fm.pt); err != nil {
+		errs = append(errs, err)
+	}
+
+	elemType := rt
+	if isRepeatedType(rt) {
+		if !fm.fts.Has(fieldRepeated) {
+			errs = append(errs, fmt.Errorf("slice field %s must be repeated", rt.String()))
+		}
+		elemType = rt.Elem()
+	} else if fm.fts.Has(fieldRepeated) {
+		errs = append(errs, fmt.Errorf("repeated field must be a slice, but %s", rt.String()))
+		return errs
+	}
+	if !fm.pt.matchGoType(elemType) {
+		errs = append(errs, fmt.Errorf("proto type %s can not be bound to %s", fm.pt, elemType.String()))
+		return errs
+	}
+	// Lazy は読み取るメッセージの型をアクセスするまで持たないので検証しません
+	if fm.pt == protoEmbed && elemType != lazyType {
+		v.validateMessage(elemType.Elem())
+	}
+	return errs
+}
@@ -0,0 +1,133 @@
+package protowire
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateType(t *testing.T) {
+	type validMessage struct {
+		Int32  int32              `protowire:"1,0,int32,optional"`
+		Packed []int64            `protowire:"2,2,int64,packed,repeated"`
+		Str    []string           `protowire:"3,2,string,repeated"`
+		Bytes  []byte             `protowire:"4,2,bytes,optional"`
+		Embed  *validMessageChild `protowire:"5,2,embed,optional"`
+	}
+	type recursiveMessage struct {
+		Name  string            `protowire:"1,2,string,optional"`
+		Child *recursiveMessage `protowire:"2,2,embed,optional"`
+	}
+	type duplicateFieldNumber struct {
+		A int32 `protowire:"1,0,int32,optional"`
+		B int64 `protowire:"1,0,int64,optional"`
+	}
+	type invalidFieldNumber struct {
+		Zero     int32 `protowire:"0,0,int32,optional"`
+		Negative int32 `protowire:"-1,0,int32,optional"`
+		Reserved int32 `protowire:"19000,0,int32,optional"`
+	}
+	type wireTypeMismatch struct {
+		Int32 int32 `protowire:"1,2,int32,optional"`
+	}
+	type packedString struct {
+		Str []string `protowire:"1,2,string,packed,repeated"`
+	}
+	type kindMismatch struct {
+		Int32 int64          `protowire:"1,0,int32,optional"`
+		Embed invalidMessage `protowire:"2,2,embed,optional"`
+	}
+	type invalidEmbed struct {
+		Child *invalidMessage `protowire:"1,2,embed,optional"`
+	}
+
+	tests := []struct {
+		name    string
+		rt      reflect.Type
+		wantLen int
+		wantErr bool
+	}{
+		{
+			name: "正しいstruct定義はエラーにならない",
+			rt:   reflect.TypeOf(validMessage{}),
+		},
+		{
+			name: "ポインタ型も検証できる",
+			rt:   reflect.TypeOf(&validMessage{}),
+		},
+		{
+			name: "再帰的なメッセージ定義も検証できる",
+			rt:   reflect.TypeOf(recursiveMessage{}),
+		},
+		{
+			name: "oneofの実装も検証できる",
+			rt:   reflect.TypeOf(testOneOf{}),
+		},
+		{
+			name: "Lazyな埋め込みメッセージも検証できる",
+			rt:   reflect.TypeOf(testLazy{}),
+		},
+		{
+			name:    "field numberが重複しているとエラー",
+			rt:      reflect.TypeOf(duplicateFieldNumber{}),
+			wantLen: 1,
+			wantErr: true,
+		},
+		{
+			name:    "field numberが0以下や予約済みの範囲だとエラー",
+			rt:      reflect.TypeOf(invalidFieldNumber{}),
+			wantLen: 3,
+			wantErr: true,
+		},
+		{
+			name:    "wire typeとproto typeが矛盾しているとエラー",
+			rt:      reflect.TypeOf(wireTypeMismatch{}),
+			wantLen: 1,
+			wantErr: true,
+		},
+		{
+			name:    "stringにpackedを指定するとエラー",
+			rt:      reflect.TypeOf(packedString{}),
+			wantLen: 1,
+			wantErr: true,
+		},
+		{
+			name:    "Goの型とproto typeが一致しないとエラーをまとめて返す",
+			rt:      reflect.TypeOf(kindMismatch{}),
+			wantLen: 2,
+			wantErr: true,
+		},
+		{
+			name:    "埋め込みメッセージも再帰的に検証する",
+			rt:      reflect.TypeOf(invalidEmbed{}),
+			wantLen: 1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateType(tt.rt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			var se *SchemaError
+			if !errors.As(err, &se) {
+				t.Fatalf("ValidateType() error = %v, want *SchemaError", err)
+			}
+			if len(se.Errors) != tt.wantLen {
+				t.Errorf("ValidateType() errors = %v, want len %d", se.Errors, tt.wantLen)
+			}
+		})
+	}
+}
+
+type validMessageChild struct {
+	Name string `protowire:"1,2,string,optional"`
+}
+
+type invalidMessage struct {
+	Float float64 `protowire:"1,5,float,optional"`
+}
@@ -0,0 +1,212 @@
+package protowire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Visitor は Walk でwireバイナリを先頭から読み進めながら、フィールドが現れるたびに呼び出されるコールバックです
+// num はそのフィールドのfield numberで、埋め込みメッセージの中では埋め込みメッセージの中でのfield numberです
+type Visitor interface {
+	// OnVarint はvarintのフィールドで呼び出されます。sint32, sint64の値はzigzagエンコードされたままです
+	OnVarint(num FieldNumber, v uint64)
+	// OnFixed32 は32-bitのフィールドで呼び出されます
+	OnFixed32(num FieldNumber, v uint32)
+	// OnFixed64 は64-bitのフィールドで呼び出されます
+	OnFixed64(num FieldNumber, v uint64)
+	// OnBytes は埋め込みメッセージとして読み取らないlength delimitedなフィールドで呼び出されます
+	// b は Walk に渡したバイト列を参照するので、呼び出しの後も使う場合はコピーする必要があります
+	OnBytes(num FieldNumber, b []byte)
+	// EnterMessage は埋め込みメッセージのフィールドで呼び出されます
+	// true を返すとメッセージの中を読み進めて最後に LeaveMessage を呼び出し、false を返すと中身を OnBytes に渡します
+	EnterMessage(num FieldNumber) (descend bool)
+	// LeaveMessage は EnterMessage で読み進めた埋め込みメッセージの終わりで呼び出されます
+	LeaveMessage(num FieldNumber)
+}
+
+// Walk はwireバイナリ b をstructにデコードせずに先頭から読み進め、フィールドが現れるたびに v のコールバックを呼び出します
+// 値はすべて b を参照したまま渡すので、大きなメッセージもメモリを割り当てずに走査できます
+//
+// schema には nil か `protowire` タグの付いたstructのポインタを指定します
+// wireバイナリだけではlength delimitedな値が埋め込みメッセージかどうかわからないので、
+// schema が nil の場合はlength delimitedな値をすべて OnBytes に渡します
+// schema を指定した場合は埋め込みメッセージのフィールドで EnterMessage を呼び出して中を読み進め、
+// packedなrepeatedのフィールドは要素ごとに OnVarint, OnFixed32, OnFixed64 を呼び出します
+// Lazy や raw の埋め込みメッセージはGoの型からスキーマがわからないので、中は schema が nil の場合と同じように読み進めます
+//
+//	err := protowire.Walk(b, v, (*wireMessage)(nil))
+func Walk(b []byte, v Visitor, schema interface{}) error {
+	var rt reflect.Type
+	if schema != nil {
+		rt = reflect.TypeOf(schema)
+		if rt.Kind() != reflect.Ptr {
+			return errors.New("schema must be a pointer")
+		}
+		rt = rt.Elem()
+		if rt.Kind() != reflect.Struct {
+			return errors.New("schema must be a struct")
+		}
+	}
+	w := walker{
+		v:       v,
+		schemas: make(map[reflect.Type]map[FieldNumber]protoFieldMetadata),
+	}
+	return w.walkMessage(b, rt)
+}
+
+// walker は Walk の状態を保持します
+// 同じ型の埋め込みメッセージが何度も現れてもstructのタグを読み直さないように、読み取ったスキーマを型ごとに保持します
+type walker struct {
+	v       Visitor
+	schemas map[reflect.Type]map[FieldNumber]protoFieldMetadata
+}
+
+// walkMessage はメッセージのバイト列 b を読み進めます。 rt はメッセージのstructの型で、スキーマがない場合は nil です
+func (w walker) walkMessage(b []byte, rt reflect.Type) error {
+	fields, err := w.schema(rt)
+	if err != nil {
+		return err
+	}
+	for len(b) > 0 {
+		fn, wt, n, err := ConsumeTag(b)
+		if err != nil {
+			return fmt.Errorf("failed to read tag: %w", err)
+		}
+		b = b[n:]
+		fm, ok := fields[fn]
+		switch wt {
+		case WireVarint:
+			var v uint64
+			v, n, err = ConsumeVarint(b)
+			if err == nil {
+				w.v.OnVarint(fn, v)
+			}
+		case WireFixed32:
+			var v uint32
+			v, n, err = ConsumeFixed32(b)
+			if err == nil {
+				w.v.OnFixed32(fn, v)
+			}
+		case WireFixed64:
+			var v uint64
+			v, n, err = ConsumeFixed64(b)
+			if err == nil {
+				w.v.OnFixed64(fn, v)
+			}
+		case WireLengthDelimited:
+			var v []byte
+			v, n, err = ConsumeBytes(b)
+			if err == nil {
+				err = w.walkLengthDelimited(fn, fm, ok, v)
+			}
+		default:
+			err = ErrInvalidWireType
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read field %d value: %w", fn, err)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// walkLengthDelimited はlength delimitedな値 b をスキーマに従って埋め込みメッセージ、packedなrepeated、それ以外のバイト列のいずれかとして読み進めます
+// inSchema はフィールドがスキーマに含まれているかで、含まれていない場合はバイト列として扱います
+func (w walker) walkLengthDelimited(fn FieldNumber, fm protoFieldMetadata, inSchema bool, b []byte) error {
+	switch {
+	case inSchema && (fm.pt == protoEmbed || fm.pt == protoRaw):
+		if !w.v.EnterMessage(fn) {
+			w.v.OnBytes(fn, b)
+			return nil
+		}
+		if err := w.walkMessage(b, embeddedSchema(fm)); err != nil {
+			return err
+		}
+		w.v.LeaveMessage(fn)
+		return nil
+	case inSchema && fm.isRepeatedScalar():
+		ptwt, _ := fm.pt.toWireType()
+		return w.walkPacked(fn, ptwt, b)
+	default:
+		w.v.OnBytes(fn, b)
+		return nil
+	}
+}
+
+// walkPacked はpackedなrepeatedの値 b を要素ごとに読み進めます。 wt は要素のwire typeです
+func (w walker) walkPacked(fn FieldNumber, wt WireType, b []byte) error {
+	for len(b) > 0 {
+		var (
+			n   int
+			err error
+		)
+		switch wt {
+		case WireVarint:
+			var v uint64
+			v, n, err = ConsumeVarint(b)
+			if err == nil {
+				w.v.OnVarint(fn, v)
+			}
+		case WireFixed32:
+			var v uint32
+			v, n, err = ConsumeFixed32(b)
+			if err == nil {
+				w.v.OnFixed32(fn, v)
+			}
+		case WireFixed64:
+			var v uint64
+			v, n, err = ConsumeFixed64(b)
+			if err == nil {
+				w.v.OnFixed64(fn, v)
+			}
+		default:
+			err = ErrInvalidWireType
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read packed element: %w", err)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// schema はstructの型 rt からfield numberごとのメタデータを返します。oneofのメンバーも同じように扱います
+// rt が nil の場合は nil を返し、すべてのフィールドがスキーマに含まれていないものとして扱われます
+func (w walker) schema(rt reflect.Type) (map[FieldNumber]protoFieldMetadata, error) {
+	if rt == nil {
+		return nil, nil
+	}
+	if fields, ok := w.schemas[rt]; ok {
+		return fields, nil
+	}
+	pm, err := newProtoMetadata(reflect.New(rt).Interface())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", rt, err)
+	}
+	fields := make(map[FieldNumber]protoFieldMetadata, len(pm.fields)+len(pm.oneOfFields))
+	for fn, fm := range pm.fields {
+		fields[fn] = fm
+	}
+	for fn, ofm := range pm.oneOfFields {
+		fields[fn] = ofm.protoFieldMetadata
+	}
+	w.schemas[rt] = fields
+	return fields, nil
+}
+
+// embeddedSchema は埋め込みメッセージのフィールドのGoの型から、メッセージのstructの型を返します
+// Lazy や raw のようにGoの型からスキーマがわからない場合は nil を返します
+func embeddedSchema(fm protoFieldMetadata) reflect.Type {
+	if fm.pt != protoEmbed {
+		return nil
+	}
+	rt := fm.rv.Type()
+	if isRepeatedType(rt) {
+		rt = rt.Elem()
+	}
+	if rt == lazyType || rt.Kind() != reflect.Ptr || rt.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	return rt.Elem()
+}
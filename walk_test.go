@@ -0,0 +1,178 @@
+package protowire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// recordVisitor は呼び出されたコールバックを文字列として記録します
+type recordVisitor struct {
+	events []string
+	// skip に含まれるfield numberの埋め込みメッセージは中を読み進めません
+	skip map[FieldNumber]bool
+}
+
+func (r *recordVisitor) OnVarint(num FieldNumber, v uint64) {
+	r.events = append(r.events, fmt.Sprintf("varint %d: %d", num, v))
+}
+
+func (r *recordVisitor) OnFixed32(num FieldNumber, v uint32) {
+	r.events = append(r.events, fmt.Sprintf("fixed32 %d: %d", num, v))
+}
+
+func (r *recordVisitor) OnFixed64(num FieldNumber, v uint64) {
+	r.events = append(r.events, fmt.Sprintf("fixed64 %d: %d", num, v))
+}
+
+func (r *recordVisitor) OnBytes(num FieldNumber, b []byte) {
+	r.events = append(r.events, fmt.Sprintf("bytes %d: %x", num, b))
+}
+
+func (r *recordVisitor) EnterMessage(num FieldNumber) bool {
+	r.events = append(r.events, fmt.Sprintf("enter %d", num))
+	return !r.skip[num]
+}
+
+func (r *recordVisitor) LeaveMessage(num FieldNumber) {
+	r.events = append(r.events, fmt.Sprintf("leave %d", num))
+}
+
+type testWalk struct {
+	Fixed32  uint32            `protowire:"6,5,fixed32,optional"`
+	Raw      RawMessage        `protowire:"7,2,raw,optional"`
+	Lazy     *Lazy             `protowire:"8,2,embed,optional"`
+	Doubles  []float64         `protowire:"9,1,double,packed,repeated"`
+	Embed    *testMergeChild   `protowire:"3,2,embed,optional"`
+	Repeated []int64           `protowire:"4,2,int64,packed,repeated"`
+	Children []*testMergeChild `protowire:"5,2,embed,repeated"`
+}
+
+func TestWalk(t *testing.T) {
+	// child は testMergeChild{Int32: 1, Str: "a"}
+	child := AppendVarint(AppendTag(nil, 1, WireVarint), 1)
+	child = AppendVarint(AppendTag(child, 2, WireLengthDelimited), 1)
+	child = append(child, 'a')
+	appendBytes := func(b []byte, num FieldNumber, v []byte) []byte {
+		b = AppendVarint(AppendTag(b, num, WireLengthDelimited), uint64(len(v)))
+		return append(b, v...)
+	}
+
+	tests := []struct {
+		name   string
+		b      []byte
+		schema interface{}
+		skip   map[FieldNumber]bool
+		want   []string
+	}{
+		{
+			name: "スキーマがなければlength delimitedな値はすべてバイト列として渡される",
+			b:    appendBytes(AppendVarint(AppendTag(nil, 1, WireVarint), 150), 3, child),
+			want: []string{
+				"varint 1: 150",
+				"bytes 3: 0801120161",
+			},
+		},
+		{
+			name:   "スキーマがあれば埋め込みメッセージの中を読み進める",
+			b:      appendBytes(appendBytes(appendBytes(nil, 3, child), 5, child), 5, nil),
+			schema: (*testWalk)(nil),
+			want: []string{
+				"enter 3", "varint 1: 1", "bytes 2: 61", "leave 3",
+				"enter 5", "varint 1: 1", "bytes 2: 61", "leave 5",
+				"enter 5", "leave 5",
+			},
+		},
+		{
+			name:   "EnterMessageがfalseを返すと中身はバイト列として渡される",
+			b:      appendBytes(nil, 3, child),
+			schema: &testWalk{},
+			skip:   map[FieldNumber]bool{3: true},
+			want:   []string{"enter 3", "bytes 3: 0801120161"},
+		},
+		{
+			name:   "oneofのメンバーの埋め込みメッセージも読み進める",
+			b:      appendBytes(nil, 1, child),
+			schema: &testOneOfKinds{},
+			want:   []string{"enter 1", "varint 1: 1", "bytes 2: 61", "leave 1"},
+		},
+		{
+			name:   "rawとLazyの埋め込みメッセージはスキーマなしで読み進める",
+			b:      appendBytes(appendBytes(nil, 7, child), 8, child),
+			schema: &testWalk{},
+			want: []string{
+				"enter 7", "varint 1: 1", "bytes 2: 61", "leave 7",
+				"enter 8", "varint 1: 1", "bytes 2: 61", "leave 8",
+			},
+		},
+		{
+			name: "packedなrepeatedは要素ごとに渡される",
+			b: appendBytes(
+				appendBytes(nil, 4, AppendVarint(AppendVarint(nil, 1), 300)),
+				9, []byte{0, 0, 0, 0, 0, 0, 0xF0, 0x3F},
+			),
+			schema: &testWalk{},
+			want:   []string{"varint 4: 1", "varint 4: 300", "fixed64 9: 4607182418800017408"},
+		},
+		{
+			name:   "32-bitの値とスキーマにないフィールドを読み取れる",
+			b:      appendBytes(append(AppendTag(nil, 6, WireFixed32), 1, 0, 0, 0), 11, []byte("x")),
+			schema: &testWalk{},
+			want:   []string{"fixed32 6: 1", "bytes 11: 78"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &recordVisitor{skip: tt.skip}
+			if err := Walk(tt.b, v, tt.schema); err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			if !reflect.DeepEqual(v.events, tt.want) {
+				t.Errorf("Walk() events = %q, want %q", v.events, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalk_error(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		schema  interface{}
+		wantErr error
+	}{
+		{
+			name:    "埋め込みメッセージの中が壊れているとエラー",
+			b:       []byte{0x1a, 0x02, 0x08, 0x80},
+			schema:  &testWalk{},
+			wantErr: ErrUnexpectedEnd,
+		},
+		{
+			name:    "packedな要素が途中で終わるとエラー",
+			b:       []byte{0x4a, 0x04, 0, 0, 0, 0},
+			schema:  &testWalk{},
+			wantErr: ErrUnexpectedEnd,
+		},
+		{
+			name:    "groupのwire typeはエラー",
+			b:       []byte{0x0b},
+			wantErr: ErrInvalidWireType,
+		},
+		{
+			name:   "スキーマがstructのポインタでなければエラー",
+			schema: testWalk{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Walk(tt.b, &recordVisitor{}, tt.schema)
+			if err == nil {
+				t.Fatal("Walk() error = nil, want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Walk() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// field numberの範囲です
+// FirstReservedNumber から LastReservedNumber まではprotobufの実装のために予約されていて、.protoで定義できません
+// https://developers.google.com/protocol-buffers/docs/proto3#assigning_field_numbers
+const (
+	MinValidNumber      FieldNumber = 1
+	MaxValidNumber      FieldNumber = 1<<29 - 1
+	FirstReservedNumber FieldNumber = 19000
+	LastReservedNumber  FieldNumber = 19999
+)
+
+// IsValid はwireバイナリに現れうるfield numberかを返します
+func (n FieldNumber) IsValid() bool {
+	return MinValidNumber <= n && n <= MaxValidNumber
+}
+
+// IsReserved はprotobufの実装のために予約されたfield numberかを返します
+func (n FieldNumber) IsReserved() bool {
+	return FirstReservedNumber <= n && n <= LastReservedNumber
+}
+
+// IsValid はこのパッケージで読み書きできるwire typeかを返します。groupはサポートしていません
+func (wt WireType) IsValid() bool {
+	switch wt {
+	case WireVarint, WireFixed64, WireLengthDelimited, WireFixed32:
+		return true
+	default:
+		return false
+	}
+}
+
+// Consume で始まる関数がバイト列を読み取れなかった場合のエラーです
+// 呼び出しごとにエラーを生成しないので、メモリを割り当てずに読み取れます
+var (
+	ErrUnexpectedEnd      = errors.New("unexpected end of bytes")
+	ErrVarintOverflow     = errors.New("varint overflows 64 bits")
+	ErrInvalidTag         = errors.New("invalid tag, tag is up to 32 bits")
+	ErrInvalidFieldNumber = errors.New("invalid field number")
+	ErrInvalidWireType    = errors.New("invalid wire type")
+)
+
+// ConsumeTag はバイト列の先頭からタグを読み取り、field numberとwire type、読み取ったバイト数を返します
+// タグの下位3bitはwire type、それ以外はfield numberです
+func ConsumeTag(b []byte) (FieldNumber, WireType, int, error) {
+	tag, n, err := ConsumeVarint(b)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	// 仕様でtype, field_number合わせて32bitまでなので超えてたらエラー
+	if tag > math.MaxUint32 {
+		return 0, 0, 0, ErrInvalidTag
+	}
+	fn := FieldNumber(tag >> 3)
+	if !fn.IsValid() {
+		return 0, 0, 0, ErrInvalidFieldNumber
+	}
+	return fn, WireType(tag & 0x7), n, nil
+}
+
+// ConsumeVarint はバイト列の先頭からvarintを読み取り、値と読み取ったバイト数を返します
+func ConsumeVarint(b []byte) (v uint64, n int, err error) {
+	// little endian で読み取っていく
+	for shift := uint(0); ; shift += 7 {
+		// 値を詰める変数vはuint64なので、shiftする値が64bitこえたらoverflow
+		if shift >= 64 {
+			return 0, 0, ErrVarintOverflow
+		}
+		if n >= len(b) {
+			return 0, 0, ErrUnexpectedEnd
+		}
+		// 対象のbyteの下位7bitを読み取ってvにつめていく
+		target := b[n]
+		n++
+		// 10byte目はuint64の最上位の1bitだけを持つので、それより大きい値はoverflow
+		if shift == 63 && target > 1 {
+			return 0, 0, ErrVarintOverflow
+		}
+		v |= uint64(target&0x7F) << shift
+		// 最上位bitが0だったら終端なのでよみとり終了
+		if target < 0x80 {
+			return v, n, nil
+		}
+	}
+}
+
+// ConsumeFixed32 はバイト列の先頭から32-bitの値を読み取り、値と読み取ったバイト数を返します
+func ConsumeFixed32(b []byte) (uint32, int, error) {
+	if len(b) < 4 {
+		return 0, 0, ErrUnexpectedEnd
+	}
+	return binary.LittleEndian.Uint32(b), 4, nil
+}
+
+// ConsumeFixed64 はバイト列の先頭から64-bitの値を読み取り、値と読み取ったバイト数を返します
+func ConsumeFixed64(b []byte) (uint64, int, error) {
+	if len(b) < 8 {
+		return 0, 0, ErrUnexpectedEnd
+	}
+	return binary.LittleEndian.Uint64(b), 8, nil
+}
+
+// ConsumeBytes はバイト列の先頭からlength delimitedな値を読み取り、先頭のバイト長を除いた中身と読み取ったバイト数を返します
+// 返すバイト列は b を参照します
+func ConsumeBytes(b []byte) ([]byte, int, error) {
+	byteLen, n, err := ConsumeVarint(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	if byteLen > uint64(len(b)-n) {
+		return nil, 0, ErrUnexpectedEnd
+	}
+	return b[n : n+int(byteLen)], n + int(byteLen), nil
+}
+
+// ConsumeFieldValue はwire typeに従ってバイト列の先頭からフィールドの値を読み飛ばし、読み飛ばしたバイト数を返します
+func ConsumeFieldValue(wt WireType, b []byte) (int, error) {
+	var (
+		n   int
+		err error
+	)
+	switch wt {
+	case WireVarint:
+		_, n, err = ConsumeVarint(b)
+	case WireFixed64:
+		_, n, err = ConsumeFixed64(b)
+	case WireLengthDelimited:
+		_, n, err = ConsumeBytes(b)
+	case WireFixed32:
+		_, n, err = ConsumeFixed32(b)
+	default:
+		return 0, ErrInvalidWireType
+	}
+	return n, err
+}
+
+// AppendTag は field numberとwire typeをタグとしてエンコードして b に追加します
+func AppendTag(b []byte, num FieldNumber, wt WireType) []byte {
+	return AppendVarint(b, uint64(num)<<3|uint64(wt&0x7))
+}
+
+// AppendVarint は v をvarintとしてエンコードして b に追加します
+func AppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// SizeVarint は v をvarintとしてエンコードした場合のバイト数を返します
+func SizeVarint(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+// EncodeZigZag はsint32, sint64の値をzigzag encodingします
+// 絶対値の小さい負の値も少ないバイト数のvarintになるように、符号を最下位bitに移します
+func EncodeZigZag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// DecodeZigZag はzigzag encodingされた値をデコードします
+func DecodeZigZag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,209 @@
+package protowire
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	wire "google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestConsumeTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		wantFn  FieldNumber
+		wantWt  WireType
+		wantN   int
+		wantErr error
+	}{
+		{
+			name:   "タグを読み取れる",
+			b:      wire.AppendTag(nil, 1, wire.VarintType),
+			wantFn: 1,
+			wantWt: WireVarint,
+			wantN:  1,
+		},
+		{
+			name:   "最大のfield numberを読み取れる",
+			b:      wire.AppendTag(nil, wire.MaxValidNumber, wire.BytesType),
+			wantFn: MaxValidNumber,
+			wantWt: WireLengthDelimited,
+			wantN:  5,
+		},
+		{
+			name:    "field number 0はエラー",
+			b:       wire.AppendTag(nil, 0, wire.VarintType),
+			wantErr: ErrInvalidFieldNumber,
+		},
+		{
+			name:    "32bitを超えるタグはエラー",
+			b:       wire.AppendVarint(nil, math.MaxUint32+1),
+			wantErr: ErrInvalidTag,
+		},
+		{
+			name:    "途中で終わっているとエラー",
+			b:       []byte{0x80},
+			wantErr: ErrUnexpectedEnd,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, wt, n, err := ConsumeTag(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConsumeTag() error = %v, want %v", err, tt.wantErr)
+			}
+			if fn != tt.wantFn || wt != tt.wantWt || n != tt.wantN {
+				t.Errorf("ConsumeTag() got = (%d, %d, %d), want (%d, %d, %d)", fn, wt, n, tt.wantFn, tt.wantWt, tt.wantN)
+			}
+		})
+	}
+}
+
+func TestConsumeVarint(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, math.MaxUint32, math.MaxUint64} {
+		b := wire.AppendVarint(nil, v)
+		got, n, err := ConsumeVarint(b)
+		if err != nil {
+			t.Fatalf("ConsumeVarint() error = %v", err)
+		}
+		if got != v || n != len(b) || n != SizeVarint(v) {
+			t.Errorf("ConsumeVarint() got = (%d, %d), want (%d, %d), SizeVarint() = %d", got, n, v, len(b), SizeVarint(v))
+		}
+		if !bytes.Equal(AppendVarint(nil, v), b) {
+			t.Errorf("AppendVarint() got = %x, want %x", AppendVarint(nil, v), b)
+		}
+	}
+	for _, b := range [][]byte{
+		bytes.Repeat([]byte{0xFF}, 11),
+		append(bytes.Repeat([]byte{0xFF}, 9), 0x7F),
+		append(bytes.Repeat([]byte{0x80}, 9), 0x02),
+	} {
+		if _, _, err := ConsumeVarint(b); !errors.Is(err, ErrVarintOverflow) {
+			t.Errorf("ConsumeVarint(%x) error = %v, want %v", b, err, ErrVarintOverflow)
+		}
+	}
+}
+
+func TestConsumeFieldValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		wt      WireType
+		b       []byte
+		wantN   int
+		wantErr error
+	}{
+		{
+			name:  "varintを読み飛ばせる",
+			wt:    WireVarint,
+			b:     wire.AppendVarint(nil, 300),
+			wantN: 2,
+		},
+		{
+			name:  "64-bitを読み飛ばせる",
+			wt:    WireFixed64,
+			b:     wire.AppendFixed64(nil, 1),
+			wantN: 8,
+		},
+		{
+			name:  "length delimitedを読み飛ばせる",
+			wt:    WireLengthDelimited,
+			b:     wire.AppendString(nil, "abc"),
+			wantN: 4,
+		},
+		{
+			name:  "32-bitを読み飛ばせる",
+			wt:    WireFixed32,
+			b:     wire.AppendFixed32(nil, 1),
+			wantN: 4,
+		},
+		{
+			name:    "length delimitedのバイト長が足りないとエラー",
+			wt:      WireLengthDelimited,
+			b:       wire.AppendString(nil, "abc")[:3],
+			wantErr: ErrUnexpectedEnd,
+		},
+		{
+			name:    "groupはサポートしていない",
+			wt:      3,
+			b:       []byte{0x00},
+			wantErr: ErrInvalidWireType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := ConsumeFieldValue(tt.wt, tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConsumeFieldValue() error = %v, want %v", err, tt.wantErr)
+			}
+			if n != tt.wantN {
+				t.Errorf("ConsumeFieldValue() got = %d, want %d", n, tt.wantN)
+			}
+		})
+	}
+}
+
+func TestConsumeFixedAndBytes(t *testing.T) {
+	if v, n, err := ConsumeFixed32(wire.AppendFixed32(nil, 12345)); err != nil || v != 12345 || n != 4 {
+		t.Errorf("ConsumeFixed32() got = (%d, %d, %v)", v, n, err)
+	}
+	if v, n, err := ConsumeFixed64(wire.AppendFixed64(nil, 67890)); err != nil || v != 67890 || n != 8 {
+		t.Errorf("ConsumeFixed64() got = (%d, %d, %v)", v, n, err)
+	}
+	if v, n, err := ConsumeBytes(wire.AppendBytes(nil, []byte("abc"))); err != nil || string(v) != "abc" || n != 4 {
+		t.Errorf("ConsumeBytes() got = (%s, %d, %v)", v, n, err)
+	}
+	if _, _, err := ConsumeFixed32([]byte{0x00}); !errors.Is(err, ErrUnexpectedEnd) {
+		t.Errorf("ConsumeFixed32() error = %v, want %v", err, ErrUnexpectedEnd)
+	}
+	if _, _, err := ConsumeFixed64([]byte{0x00}); !errors.Is(err, ErrUnexpectedEnd) {
+		t.Errorf("ConsumeFixed64() error = %v, want %v", err, ErrUnexpectedEnd)
+	}
+}
+
+func TestAppendTag(t *testing.T) {
+	got := AppendTag(nil, 12345, WireFixed32)
+	want := wire.AppendTag(nil, 12345, wire.Fixed32Type)
+	if !bytes.Equal(got, want) {
+		t.Errorf("AppendTag() got = %x, want %x", got, want)
+	}
+}
+
+func TestZigZag(t *testing.T) {
+	for _, v := range []int64{0, -1, 1, math.MinInt32, math.MaxInt32, math.MinInt64, math.MaxInt64} {
+		if got, want := EncodeZigZag(v), wire.EncodeZigZag(v); got != want {
+			t.Errorf("EncodeZigZag(%d) got = %d, want %d", v, got, want)
+		}
+		if got := DecodeZigZag(EncodeZigZag(v)); got != v {
+			t.Errorf("DecodeZigZag() got = %d, want %d", got, v)
+		}
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	if FieldNumber(0).IsValid() || !FieldNumber(1).IsValid() || FieldNumber(MaxValidNumber+1).IsValid() {
+		t.Errorf("FieldNumber.IsValid() returns unexpected result")
+	}
+	if !FieldNumber(19000).IsReserved() || FieldNumber(20000).IsReserved() {
+		t.Errorf("FieldNumber.IsReserved() returns unexpected result")
+	}
+	if !WireFixed32.IsValid() || WireType(3).IsValid() || WireType(4).IsValid() {
+		t.Errorf("WireType.IsValid() returns unexpected result")
+	}
+}
+
+func TestConsume_allocs(t *testing.T) {
+	b := wire.AppendTag(nil, 1, wire.BytesType)
+	b = wire.AppendString(b, "abc")
+	allocs := testing.AllocsPerRun(100, func() {
+		_, wt, n, _ := ConsumeTag(b)
+		ConsumeFieldValue(wt, b[n:])
+		ConsumeBytes(b[n:])
+		// エラーの場合もメモリを割り当てない
+		ConsumeVarint(nil)
+	})
+	if allocs != 0 {
+		t.Errorf("Consume functions allocate %v times", allocs)
+	}
+}